@@ -0,0 +1,143 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// The modes of the baseline command line flag.
+const (
+	baselineModeWrite = "write"
+	baselineModeCheck = "check"
+)
+
+// baseline is the content of a baseline file. It holds the functions which
+// matched when it was written, so they aren't reported when it's checked.
+type baseline struct {
+	Entries []baselineEntry `json:"entries"`
+}
+
+// baselineEntry identifies a function which matches a rule. It doesn't contain
+// any position, so refactors which move a function don't invalidate it.
+type baselineEntry struct {
+	Rule    string `json:"rule"`
+	Package string `json:"package"`
+	Func    string `json:"func"`
+}
+
+func (e baselineEntry) String() string {
+	return fmt.Sprintf("%s: %s: %s", e.Package, e.Func, e.Rule)
+}
+
+// newBaseline creates a baseline with the not suppressed functions of results.
+// The entries are sorted by rule, package and function.
+func newBaseline(results []ruleResult) baseline {
+	var bl baseline
+	for _, rr := range results {
+		for _, fbf := range rr.funcsFiles {
+			for _, fname := range fbf.FuncNames {
+				bl.Entries = append(bl.Entries, baselineEntry{
+					Rule:    rr.rule.name,
+					Package: fbf.PkgPath,
+					Func:    fname,
+				})
+			}
+		}
+	}
+
+	sortBaselineEntries(bl.Entries)
+	return bl
+}
+
+// writeBaseline writes the baseline of results into the file filename.
+func writeBaseline(filename string, results []ruleResult) error {
+	data, err := json.MarshalIndent(newBaseline(results), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error while encoding baseline: %v", err)
+	}
+
+	if err := os.WriteFile(filename, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error while writing baseline file: %v", err)
+	}
+
+	return nil
+}
+
+// readBaseline reads the baseline file filename.
+func readBaseline(filename string) (baseline, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return baseline{}, fmt.Errorf("error while reading baseline file: %v", err)
+	}
+
+	var bl baseline
+	if err := json.Unmarshal(data, &bl); err != nil {
+		return baseline{}, fmt.Errorf("invalid baseline: %v. Baseline file: %s", err, filename)
+	}
+
+	return bl, nil
+}
+
+// check removes from results the functions which are in bl and returns the
+// remaining results and the bl entries which aren't in results anymore, sorted
+// by rule, package and function.
+func (bl baseline) check(results []ruleResult) ([]ruleResult, []baselineEntry) {
+	known := make(map[baselineEntry]bool, len(bl.Entries))
+	for _, e := range bl.Entries {
+		known[e] = false
+	}
+
+	newResults := make([]ruleResult, len(results))
+	for i, rr := range results {
+		newResults[i].rule = rr.rule
+		for _, fbf := range rr.funcsFiles {
+			var fnames []string
+			for _, fname := range fbf.FuncNames {
+				e := baselineEntry{Rule: rr.rule.name, Package: fbf.PkgPath, Func: fname}
+				if _, ok := known[e]; ok {
+					known[e] = true
+					continue
+				}
+
+				fnames = append(fnames, fname)
+			}
+
+			if len(fnames) == 0 && len(fbf.SuppressedFuncNames) == 0 {
+				continue
+			}
+
+			fbf.FuncNames = fnames
+			newResults[i].funcsFiles = append(newResults[i].funcsFiles, fbf)
+		}
+	}
+
+	var gone []baselineEntry
+	for e, found := range known {
+		if !found {
+			gone = append(gone, e)
+		}
+	}
+
+	sortBaselineEntries(gone)
+	return newResults, gone
+}
+
+func sortBaselineEntries(entries []baselineEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+
+		return a.Func < b.Func
+	})
+}
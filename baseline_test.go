@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaselineCheck(t *testing.T) {
+	var (
+		ra = rule{name: "a"}
+		rb = rule{name: "b"}
+	)
+	results := []ruleResult{
+		{
+			rule: ra,
+			funcsFiles: []funcsByFile{
+				{PkgPath: "x/p", Filename: "x/p/a.go", FuncNames: []string{"F1", "T.M"}},
+				{PkgPath: "x/p", Filename: "x/p/b.go", FuncNames: []string{"F2"}},
+				{PkgPath: "x/q", Filename: "x/q/a.go", FuncNames: []string{"F1"}, SuppressedFuncNames: []string{"F3"}},
+			},
+		},
+		{
+			rule: rb,
+			funcsFiles: []funcsByFile{
+				{PkgPath: "x/p", Filename: "x/p/a.go", FuncNames: []string{"F1"}},
+			},
+		},
+	}
+
+	bl := baseline{Entries: []baselineEntry{
+		{Rule: "a", Package: "x/p", Func: "F1"},
+		{Rule: "a", Package: "x/p", Func: "F2"},
+		{Rule: "a", Package: "x/q", Func: "F1"},
+		{Rule: "a", Package: "x/q", Func: "F9"},
+		{Rule: "c", Package: "x/p", Func: "F1"},
+	}}
+
+	newResults, gone := bl.check(results)
+	assert.Equal(t, []ruleResult{
+		{
+			rule: ra,
+			funcsFiles: []funcsByFile{
+				{PkgPath: "x/p", Filename: "x/p/a.go", FuncNames: []string{"T.M"}},
+				{PkgPath: "x/q", Filename: "x/q/a.go", SuppressedFuncNames: []string{"F3"}},
+			},
+		},
+		{
+			rule: rb,
+			funcsFiles: []funcsByFile{
+				{PkgPath: "x/p", Filename: "x/p/a.go", FuncNames: []string{"F1"}},
+			},
+		},
+	}, newResults)
+	assert.Equal(t, []baselineEntry{
+		{Rule: "a", Package: "x/q", Func: "F9"},
+		{Rule: "c", Package: "x/p", Func: "F1"},
+	}, gone)
+}
+
+func TestRunBaseline(t *testing.T) {
+	const testpkg = "github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/testpkg"
+	blFile := filepath.Join(t.TempDir(), "baseline.json")
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{
+		"-fail-on-match", "-funcs", "net/http/cookiejar.Jar.Cookies", "-baseline", "write", "-baseline-file", blFile, testpkg,
+	}, &stdout, &stderr)
+	require.Equal(t, exitCodeOK, code, "stderr: %s", stderr.String())
+
+	bl, err := readBaseline(blFile)
+	require.NoError(t, err)
+	assert.Equal(t, []baselineEntry{
+		{Rule: defaultRuleName, Package: testpkg, Func: "*unexportedType.ExportedMethod"},
+		{Rule: defaultRuleName, Package: testpkg, Func: "ExportedType.unexportedMethod"},
+		{Rule: defaultRuleName, Package: testpkg, Func: "unexportedFunc"},
+	}, bl.Entries)
+
+	stdout.Reset()
+	stderr.Reset()
+	code = run([]string{
+		"-fail-on-match", "-funcs", "net/http/cookiejar.Jar.Cookies", "-baseline", "check", "-baseline-file", blFile, testpkg,
+	}, &stdout, &stderr)
+	require.Equal(t, exitCodeOK, code, "stderr: %s", stderr.String())
+	assert.Empty(t, stdout.String())
+	assert.Empty(t, stderr.String())
+
+	// Replace an entry by one which doesn't exist.
+	bl.Entries[2].Func = "removedFunc"
+	data, err := json.Marshal(bl)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(blFile, data, 0644))
+
+	stdout.Reset()
+	stderr.Reset()
+	code = run([]string{
+		"-fail-on-match", "-funcs", "net/http/cookiejar.Jar.Cookies", "-baseline", "check", "-baseline-file", blFile, testpkg,
+	}, &stdout, &stderr)
+	require.Equal(t, exitCodeMatches, code, "stderr: %s", stderr.String())
+	assert.Equal(t, 1, strings.Count(stdout.String(), "\n"))
+	assert.Contains(t, stdout.String(), ": unexportedFunc: default[warning]\n")
+	assert.Contains(t, stderr.String(),
+		"warning: baseline entry doesn't match anymore: "+testpkg+": removedFunc: default\n",
+	)
+}
+
+func TestParamsBaseline(t *testing.T) {
+	_, err := params([]string{"-funcs", "strings.Compare", "-baseline", "write", "./..."})
+	require.Error(t, err)
+
+	_, err = params([]string{"-funcs", "strings.Compare", "-baseline", "update", "-baseline-file", "bl.json", "./..."})
+	require.Error(t, err)
+
+	cmdp, err := params([]string{"-funcs", "strings.Compare", "-baseline", "check", "-baseline-file", "bl.json", "./..."})
+	require.NoError(t, err)
+	assert.Equal(t, baselineModeCheck, cmdp.baselineMode)
+	assert.Equal(t, "bl.json", cmdp.baselineFile)
+	assert.Equal(t, []string{"./..."}, cmdp.pkgsPatterns)
+}
@@ -0,0 +1,367 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// indexCacheVersion is the version of the format of the cached indexes. It must
+// be changed whenever the format or the way of building the indexes change, so
+// the entries of previous versions aren't used.
+const indexCacheVersion = "7"
+
+// loadIndexes loads the packages which match pkgsPatterns, relative to dir,
+// and returns their callee indexes, built according to opts concurrently by
+// workers goroutines, and the type information of them and all their
+// dependencies.
+//
+// When cacheDir isn't empty, the indexes of the packages which haven't changed
+// since they were stored in it are read from it without loading their syntax
+// nor their type information, and the indexes of the rest of packages are
+// stored in it.
+func loadIndexes(
+	dir string, pkgsPatterns []string, cacheDir string, opts indexOptions, workers int,
+) ([]*pkgIndex, typesPackages, error) {
+	if cacheDir == "" {
+		pkgs, err := loadPackages(dir, pkgsPatterns)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		idxs, err := indexPackages(pkgs, opts, workers)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return idxs, newTypesPackages(pkgs), nil
+	}
+
+	ic := &indexCache{dir: cacheDir, opts: opts, hashes: map[string]string{}}
+	return ic.load(dir, pkgsPatterns, workers)
+}
+
+// loadSetKeys returns the keys of a set of packages which are loaded together
+// from their keys, so each key also depends on the rest of packages. All the
+// keys are empty when any of them is empty, because the packages which cannot
+// be cached cannot be compared with the cached ones.
+func loadSetKeys(keys []string) []string {
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+
+	h := sha256.New()
+	for _, k := range sorted {
+		if k == "" {
+			return make([]string, len(keys))
+		}
+
+		fmt.Fprintf(h, "%s\n", k)
+	}
+
+	set := hex.EncodeToString(h.Sum(nil))
+	setKeys := make([]string, len(keys))
+	for i, k := range keys {
+		sum := sha256.Sum256([]byte(k + " " + set))
+		setKeys[i] = hex.EncodeToString(sum[:])
+	}
+
+	return setKeys
+}
+
+// indexCache is a directory which stores the callee indexes of the packages.
+// Each index is stored in a file whose name is the key of its package, which
+// is the hash of the contents of its files and of the export data of all its
+// dependencies, so an entry is never used after the package or any of its
+// dependencies change.
+//
+// The indirect calls of a package depend on the function values which the
+// rest of the loaded packages pass to it, so with opts.indirect the keys also
+// have the keys of all the loaded packages, hence any change invalidates all
+// the entries and the packages are only read from the cache when they are
+// loaded with the same packages.
+type indexCache struct {
+	dir string
+	// opts are the options which build the indexes, which are part of the keys
+	// because the indexes built with different options may differ.
+	opts indexOptions
+	// hashes are the hashes of the contents of the files, by filename.
+	hashes map[string]string
+}
+
+// load returns the indexes of the packages which match pkgsPatterns, relative
+// to dir, and the paths of them and all their dependencies with the type
+// information of the ones which weren't in the cache. The ones which aren't in
+// the cache are loaded, indexed by workers goroutines and stored in the cache.
+func (ic *indexCache) load(dir string, pkgsPatterns []string, workers int) ([]*pkgIndex, typesPackages, error) {
+	// The export data is produced by the go command, which uses its build
+	// cache, hence it's much cheaper than type checking the packages.
+	pkgs, err := packages.Load(&packages.Config{
+		Dir: dir,
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles |
+			packages.NeedImports | packages.NeedDeps | packages.NeedModule | packages.NeedExportFile,
+	}, pkgsPatterns...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error while loading packages: [%s]. %s",
+			strings.Join(pkgsPatterns, ", "), err,
+		)
+	}
+
+	var (
+		idxs     = make([]*pkgIndex, len(pkgs))
+		keys     = make([]string, len(pkgs))
+		missed   = map[string]int{}
+		patterns []string
+		deep     = map[*packages.Package]string{}
+	)
+	for i, p := range pkgs {
+		key, err := ic.key(p, deep)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		keys[i] = key
+	}
+
+	if ic.opts.indirect {
+		keys = loadSetKeys(keys)
+	}
+
+	for i, p := range pkgs {
+		if key := keys[i]; key != "" {
+			if idx := ic.get(key); idx != nil && idx.PkgPath == p.PkgPath {
+				idxs[i] = idx
+				continue
+			}
+		}
+
+		missed[p.PkgPath] = i
+		patterns = append(patterns, p.PkgPath)
+	}
+
+	tp := newTypesPackages(pkgs)
+	if len(patterns) == 0 {
+		return idxs, tp, nil
+	}
+
+	// The packages which aren't in any module nor GOPATH, e.g. the ones
+	// specified by a list of files, cannot be loaded by their path, and the
+	// indirect calls are only the same when all the packages are loaded.
+	if _, ok := missed["command-line-arguments"]; ok || ic.opts.indirect {
+		patterns = pkgsPatterns
+	}
+
+	loaded, err := loadPackages(dir, patterns)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lidxs, err := indexPackages(loaded, ic.opts, workers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for path, typ := range newTypesPackages(loaded) {
+		tp[path] = typ
+	}
+
+	for _, idx := range lidxs {
+		i, ok := missed[idx.PkgPath]
+		if !ok {
+			continue
+		}
+
+		idxs[i] = idx
+		if keys[i] != "" {
+			if err := ic.put(keys[i], idx); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	for i, idx := range idxs {
+		if idx == nil {
+			return nil, nil, fmt.Errorf("package %s not found after loading it", pkgs[i].PkgPath)
+		}
+	}
+
+	return idxs, tp, nil
+}
+
+// key returns the cache key of pkg. It returns an empty key if pkg cannot be
+// cached, e.g. it has errors. deep memoizes the hashes of the export data of
+// the packages and all their dependencies.
+func (ic *indexCache) key(pkg *packages.Package, deep map[*packages.Package]string) (string, error) {
+	if len(pkg.Errors) > 0 {
+		return "", nil
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "version %s %s\n", indexCacheVersion, runtime.Version())
+	fmt.Fprintf(h, "backend %s indirect %t\n", ic.opts.backend, ic.opts.indirect)
+	fmt.Fprintf(h, "package %s %s\n", pkg.ID, pkg.PkgPath)
+	if pkg.Module != nil {
+		fmt.Fprintf(h, "module %s %s\n", pkg.Module.Path, pkg.Module.Dir)
+	}
+
+	for _, f := range pkg.GoFiles {
+		fmt.Fprintf(h, "go %s\n", f)
+	}
+
+	for _, f := range pkg.CompiledGoFiles {
+		fh, err := ic.fileHash(f)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(h, "compiled %s %s\n", f, fh)
+	}
+
+	var imports []string
+	for path := range pkg.Imports {
+		imports = append(imports, path)
+	}
+	sort.Strings(imports)
+
+	for _, path := range imports {
+		dh, err := ic.deepHash(pkg.Imports[path], deep)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(h, "import %s %s\n", path, dh)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// deepHash returns the hash of the export data of pkg and of all its
+// dependencies. The type information of a package may refer to the types
+// declared in any of its dependencies, not only in the ones which it imports.
+func (ic *indexCache) deepHash(pkg *packages.Package, deep map[*packages.Package]string) (string, error) {
+	if dh, ok := deep[pkg]; ok {
+		return dh, nil
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "package %s\n", pkg.PkgPath)
+	if pkg.ExportFile != "" {
+		fh, err := ic.fileHash(pkg.ExportFile)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(h, "export %s\n", fh)
+	} else {
+		// The packages without export data, e.g. because they have errors,
+		// are identified by their files.
+		for _, f := range pkg.CompiledGoFiles {
+			fh, err := ic.fileHash(f)
+			if err != nil {
+				return "", err
+			}
+
+			fmt.Fprintf(h, "compiled %s %s\n", f, fh)
+		}
+	}
+
+	var imports []string
+	for path := range pkg.Imports {
+		imports = append(imports, path)
+	}
+	sort.Strings(imports)
+
+	for _, path := range imports {
+		dh, err := ic.deepHash(pkg.Imports[path], deep)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(h, "import %s %s\n", path, dh)
+	}
+
+	dh := hex.EncodeToString(h.Sum(nil))
+	deep[pkg] = dh
+	return dh, nil
+}
+
+// fileHash returns the hash of the content of the file filename.
+func (ic *indexCache) fileHash(filename string) (string, error) {
+	if fh, ok := ic.hashes[filename]; ok {
+		return fh, nil
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", fmt.Errorf("error while reading file for the cache key: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("error while reading file for the cache key: %v", err)
+	}
+
+	fh := hex.EncodeToString(h.Sum(nil))
+	ic.hashes[filename] = fh
+	return fh, nil
+}
+
+// get returns the index stored with key. It returns nil if there isn't any or
+// it cannot be read.
+func (ic *indexCache) get(key string) *pkgIndex {
+	data, err := os.ReadFile(filepath.Join(ic.dir, key+".json"))
+	if err != nil {
+		return nil
+	}
+
+	var idx pkgIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil
+	}
+
+	return &idx
+}
+
+// put stores idx with key. The file is written atomically, so concurrent
+// executions never read a partially written index.
+func (ic *indexCache) put(key string, idx *pkgIndex) error {
+	if err := os.MkdirAll(ic.dir, 0o755); err != nil {
+		return fmt.Errorf("error while creating cache directory: %v", err)
+	}
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return fmt.Errorf("error while encoding index of package %s: %v", idx.PkgPath, err)
+	}
+
+	f, err := os.CreateTemp(ic.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error while writing cache: %v", err)
+	}
+
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(ic.dir, key+".json"))
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("error while writing cache: %v", err)
+	}
+
+	return nil
+}
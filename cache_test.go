@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadIndexesCache(t *testing.T) {
+	var (
+		modDir   = t.TempDir()
+		cacheDir = t.TempDir()
+	)
+	writeFile := func(name string, content string) {
+		t.Helper()
+		filename := filepath.Join(modDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0o755))
+		require.NoError(t, os.WriteFile(filename, []byte(content), 0o644))
+	}
+
+	writeFile("go.mod", "module example.com/cachetest\n\ngo 1.22\n")
+	writeFile("b/b.go", "package b\n\ntype Client struct{}\n\nfunc (Client) Do() {}\n")
+	writeFile("a/a.go", `package a
+
+import "example.com/cachetest/b"
+
+type S struct{ C b.Client }
+
+func F(s S) { s.C.Do() }
+`)
+	writeFile("c/c.go", "package c\n\nimport \"strings\"\n\nfunc G() { strings.Compare(\"a\", \"b\") }\n")
+
+	patterns := []string{"./..."}
+	uncached, _, err := loadIndexes(modDir, patterns, "", indexOptions{}, 0)
+	require.NoError(t, err)
+
+	cached, _, err := loadIndexes(modDir, patterns, cacheDir, indexOptions{}, 0)
+	require.NoError(t, err)
+	require.Equal(t, uncached, cached)
+
+	entries, err := filepath.Glob(filepath.Join(cacheDir, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	// Mark the cached indexes for detecting which ones are read from the cache.
+	for _, e := range entries {
+		data, err := os.ReadFile(e)
+		require.NoError(t, err)
+
+		var idx pkgIndex
+		require.NoError(t, json.Unmarshal(data, &idx))
+		idx.Module = "cached"
+
+		data, err = json.Marshal(idx)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(e, data, 0o644))
+	}
+
+	modules := func() map[string]string {
+		t.Helper()
+		idxs, _, err := loadIndexes(modDir, patterns, cacheDir, indexOptions{}, 0)
+		require.NoError(t, err)
+
+		mods := map[string]string{}
+		for _, idx := range idxs {
+			mods[idx.PkgPath] = idx.Module
+		}
+
+		return mods
+	}
+
+	assert.Equal(t, map[string]string{
+		"example.com/cachetest/a": "cached",
+		"example.com/cachetest/b": "cached",
+		"example.com/cachetest/c": "cached",
+	}, modules())
+
+	// The indexes of each backend are cached apart.
+	ssaIdxs, _, err := loadIndexes(modDir, patterns, cacheDir, indexOptions{backend: backendSSA}, 0)
+	require.NoError(t, err)
+	require.Len(t, ssaIdxs, 3)
+	for _, idx := range ssaIdxs {
+		assert.Equal(t, "example.com/cachetest", idx.Module, idx.PkgPath)
+	}
+
+	// Changing the API of b invalidates b and a, which depends on it.
+	writeFile("b/b.go", "package b\n\ntype Client struct{ Timeout int }\n\nfunc (Client) Do() {}\n")
+	assert.Equal(t, map[string]string{
+		"example.com/cachetest/a": "example.com/cachetest",
+		"example.com/cachetest/b": "example.com/cachetest",
+		"example.com/cachetest/c": "cached",
+	}, modules())
+
+	// Changing a file only invalidates its package.
+	writeFile("c/c.go", "package c\n\nimport \"strings\"\n\nfunc H() { strings.Compare(\"a\", \"b\") }\n")
+	mods := modules()
+	assert.Equal(t, "example.com/cachetest", mods["example.com/cachetest/c"])
+
+	idxs, _, err := loadIndexes(modDir, []string{"./c"}, cacheDir, indexOptions{}, 0)
+	require.NoError(t, err)
+	require.Len(t, idxs, 1)
+	require.Len(t, idxs[0].Files, 1)
+	require.Len(t, idxs[0].Files[0].Funcs, 1)
+	assert.Equal(t, "H", idxs[0].Files[0].Funcs[0].ID)
+}
+
+func TestLoadIndexesCacheIndirect(t *testing.T) {
+	var (
+		modDir   = t.TempDir()
+		cacheDir = t.TempDir()
+		opts     = indexOptions{indirect: true}
+	)
+	writeFile := func(name string, content string) {
+		t.Helper()
+		filename := filepath.Join(modDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0o755))
+		require.NoError(t, os.WriteFile(filename, []byte(content), 0o644))
+	}
+
+	writeFile("go.mod", "module example.com/cachetest\n\ngo 1.22\n")
+	writeFile("b/b.go", "package b\n\nfunc Run(f func(string, string) int) int { return f(\"a\", \"b\") }\n")
+	writeFile("a/a.go", `package a
+
+import (
+	"strings"
+
+	"example.com/cachetest/b"
+)
+
+func A() int { return b.Run(strings.Compare) }
+`)
+
+	// load returns the indexes loaded with and without the cache, which must
+	// be the same, and the indirect callees of b.Run.
+	load := func(patterns ...string) []callee {
+		t.Helper()
+		uncached, _, err := loadIndexes(modDir, patterns, "", opts, 0)
+		require.NoError(t, err)
+
+		for i := 0; i < 2; i++ {
+			cached, _, err := loadIndexes(modDir, patterns, cacheDir, opts, 0)
+			require.NoError(t, err)
+			require.Equal(t, uncached, cached)
+		}
+
+		var indirect []callee
+		for _, idx := range uncached {
+			if idx.PkgPath != "example.com/cachetest/b" {
+				continue
+			}
+
+			for _, fn := range idx.Files[0].Funcs {
+				for _, c := range fn.Callees {
+					if c.Indirect {
+						indirect = append(indirect, c)
+					}
+				}
+			}
+		}
+
+		return indirect
+	}
+
+	indirect := load("./...")
+	require.Len(t, indirect, 1)
+	assert.Equal(t, "strings", indirect[0].Pkg)
+	assert.Equal(t, "Compare", indirect[0].Name)
+
+	// b.Run doesn't call strings.Compare after a stops passing it, although b
+	// hasn't changed.
+	writeFile("a/a.go", `package a
+
+import "example.com/cachetest/b"
+
+func A() int { return b.Run(func(string, string) int { return 0 }) }
+`)
+	assert.Empty(t, load("./..."))
+
+	// Nothing passes functions to b.Run when b is loaded alone.
+	writeFile("a/a.go", `package a
+
+import (
+	"strings"
+
+	"example.com/cachetest/b"
+)
+
+func A() int { return b.Run(strings.Compare) }
+`)
+	require.Len(t, load("./..."), 1)
+	assert.Empty(t, load("./b"))
+}
+
+func TestRunCache(t *testing.T) {
+	const testpkg = "github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/testpkg"
+
+	cacheDir := t.TempDir()
+	var outputs []string
+	for i := 0; i < 2; i++ {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-cache", cacheDir, "-funcs", "strings.Compare", testpkg}, &stdout, &stderr)
+		require.Equal(t, exitCodeOK, code, "stderr: %s", stderr.String())
+		outputs = append(outputs, stdout.String())
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-funcs", "strings.Compare", testpkg}, &stdout, &stderr)
+	require.Equal(t, exitCodeOK, code, "stderr: %s", stderr.String())
+
+	assert.NotEmpty(t, stdout.String())
+	assert.Equal(t, []string{stdout.String(), stdout.String()}, outputs)
+}
@@ -0,0 +1,164 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"go/token"
+	"strings"
+)
+
+// callGraph links the functions of a set of package indexes with the
+// functions of the same set which they call, so the calls can be followed
+// transitively, i.e. a function calls a function if it calls it directly or
+// it calls a function which calls it.
+//
+// The callees are resolved by their names, as the indexes don't have type
+// information, so a call is linked to all the declared functions which it may
+// refer to. A callGraph isn't safe for concurrent use.
+type callGraph struct {
+	nodes []callNode
+	// calls are the calls of each node to other nodes and callers the calls
+	// to each node from other nodes, both indexed by node.
+	calls   [][]callEdge
+	callers [][]callEdge
+	// reached memoizes the results of reaching.
+	reached map[funcCall]map[*funcIndex][]token.Position
+}
+
+// callNode is a function of a callGraph.
+type callNode struct {
+	idx *pkgIndex
+	fi  *fileIndex
+	fn  *funcIndex
+}
+
+// callEdge is a call between the nodes of a callGraph. node is the callee in
+// the calls of a node and the caller in its callers.
+type callEdge struct {
+	node int
+	pos  token.Position
+}
+
+// newCallGraph returns the call graph of the functions of idxs.
+func newCallGraph(idxs []*pkgIndex) *callGraph {
+	g := &callGraph{reached: map[funcCall]map[*funcIndex][]token.Position{}}
+	byName := map[string][]int{}
+	for _, idx := range idxs {
+		for i := range idx.Files {
+			fi := &idx.Files[i]
+			for j := range fi.Funcs {
+				fn := &fi.Funcs[j]
+				name := qualifiedFuncName(idx.PkgPath, withoutTypeParams(fn.ID))
+				byName[name] = append(byName[name], len(g.nodes))
+				g.nodes = append(g.nodes, callNode{idx: idx, fi: fi, fn: fn})
+			}
+		}
+	}
+
+	g.calls = make([][]callEdge, len(g.nodes))
+	g.callers = make([][]callEdge, len(g.nodes))
+	for n, cn := range g.nodes {
+		for _, c := range cn.fn.Callees {
+			var names []string
+			switch c.Kind {
+			case calleeLocal:
+				names = []string{qualifiedFuncName(cn.idx.PkgPath, c.Name)}
+			case calleeImport:
+				names = []string{qualifiedFuncName(c.Pkg, c.Name)}
+			default:
+				names = []string{
+					qualifiedFuncName(c.Pkg, c.Receiver+"."+c.Name),
+					qualifiedFuncName(c.Pkg, "*"+c.Receiver+"."+c.Name),
+				}
+			}
+
+			for _, name := range names {
+				for _, m := range byName[name] {
+					g.calls[n] = append(g.calls[n], callEdge{node: m, pos: c.Pos})
+					g.callers[m] = append(g.callers[m], callEdge{node: n, pos: c.Pos})
+				}
+			}
+		}
+	}
+
+	return g
+}
+
+// withoutTypeParams returns the function identifier funcID, as returned by
+// functionIdentifier, without the type parameters of its receiver, e.g. "T.M"
+// for "T[K].M", because the callees refer to the methods of the generic types
+// without them.
+func withoutTypeParams(funcID string) string {
+	i := strings.Index(funcID, "[")
+	if i < 0 {
+		return funcID
+	}
+
+	return funcID[:i] + funcID[strings.LastIndex(funcID, "]")+1:]
+}
+
+// reaching returns the functions of g which call fc directly or transitively
+// with the positions of their calls which lead to fc.
+func (g *callGraph) reaching(fc funcCall) map[*funcIndex][]token.Position {
+	if reached, ok := g.reached[fc]; ok {
+		return reached
+	}
+
+	var (
+		direct = map[int][]token.Position{}
+		queue  []int
+	)
+	for n, cn := range g.nodes {
+		lfc := fc
+		if lfc.pkg == analyzedPkg {
+			lfc.pkg = cn.idx.PkgPath
+		}
+
+		for _, c := range cn.fn.Callees {
+			if c.matches(lfc, cn.idx.PkgPath) {
+				direct[n] = append(direct[n], c.Pos)
+			}
+		}
+
+		if _, ok := direct[n]; ok {
+			queue = append(queue, n)
+		}
+	}
+
+	visited := make([]bool, len(g.nodes))
+	for _, n := range queue {
+		visited[n] = true
+	}
+
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, e := range g.callers[n] {
+			if !visited[e.node] {
+				visited[e.node] = true
+				queue = append(queue, e.node)
+			}
+		}
+	}
+
+	reached := map[*funcIndex][]token.Position{}
+	for n, v := range visited {
+		if !v {
+			continue
+		}
+
+		pos := direct[n]
+		for _, e := range g.calls[n] {
+			if visited[e.node] {
+				pos = append(pos, e.pos)
+			}
+		}
+
+		fn := g.nodes[n].fn
+		reached[fn] = append(reached[fn], pos...)
+	}
+
+	g.reached[fc] = reached
+	return reached
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallGraphReaching(t *testing.T) {
+	modDir, writeFile := newWatchModule(t)
+	writeFile("b/b.go", `package b
+
+import "example.com/watchtest/a"
+
+type T struct{}
+
+func (t *T) M() { a.F() }
+
+func G() { h() }
+
+func h() {
+	var t T
+	t.M()
+}
+
+func Loop() { loop() }
+
+func loop() { Loop() }
+
+type P[K comparable, V any] struct{}
+
+func (p *P[K, V]) M() { a.F() }
+
+func Gen() {
+	var p P[int, string]
+	p.M()
+}
+`)
+
+	pkgs, err := loadPackages(modDir, []string{"./..."})
+	require.NoError(t, err)
+	idxs, err := indexPackages(pkgs, indexOptions{}, 0)
+	require.NoError(t, err)
+
+	g := newCallGraph(idxs)
+	names := func(fc funcCall) []string {
+		var names []string
+		for _, idx := range idxs {
+			for i := range idx.Files {
+				for j := range idx.Files[i].Funcs {
+					fn := &idx.Files[i].Funcs[j]
+					if _, ok := g.reaching(fc)[fn]; ok {
+						names = append(names, qualifiedFuncName(idx.PkgPath, fn.ID))
+					}
+				}
+			}
+		}
+
+		sort.Strings(names)
+		return names
+	}
+
+	assert.Equal(t, []string{
+		"(*example.com/watchtest/b.P[K, V]).M",
+		"(*example.com/watchtest/b.T).M",
+		"example.com/watchtest/a.F",
+		"example.com/watchtest/b.G",
+		"example.com/watchtest/b.Gen",
+		"example.com/watchtest/b.h",
+	}, names(funcCall{pkg: "strings", funcName: "Compare"}))
+
+	assert.Equal(t, []string{
+		"example.com/watchtest/b.Loop",
+		"example.com/watchtest/b.loop",
+	}, names(funcCall{pkg: "example.com/watchtest/b", funcName: "Loop"}))
+
+	assert.Empty(t, names(funcCall{pkg: "strings", funcName: "Index"}))
+
+	t.Run("positions", func(t *testing.T) {
+		reached := g.reaching(funcCall{pkg: "strings", funcName: "Compare"})
+		for _, idx := range idxs {
+			for i := range idx.Files {
+				for j := range idx.Files[i].Funcs {
+					fn := &idx.Files[i].Funcs[j]
+					if fn.ID == "h" {
+						require.Len(t, reached[fn], 1)
+						assert.Equal(t, filepath.Join(modDir, "b", "b.go"), reached[fn][0].Filename)
+						assert.Equal(t, 13, reached[fn][0].Line)
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("find", func(t *testing.T) {
+		r := rule{
+			name:      defaultRuleName,
+			funcCalls: []funcCall{{pkg: "strings", funcName: "Compare"}},
+		}
+
+		direct := findRule(idxs, r, nil, findOptions{})
+		assert.Equal(t, 1, countMatches(direct))
+
+		transitive := findRule(idxs, r, nil, findOptions{calls: g})
+		assert.Equal(t, 6, countMatches(transitive))
+	})
+}
+
+func TestWithoutTypeParams(t *testing.T) {
+	assert.Equal(t, "F", withoutTypeParams("F"))
+	assert.Equal(t, "T.M", withoutTypeParams("T.M"))
+	assert.Equal(t, "T.M", withoutTypeParams("T[K].M"))
+	assert.Equal(t, "*T.M", withoutTypeParams("*T[K, V].M"))
+}
@@ -0,0 +1,262 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// defaultRuleName is the name of the rule created from the command line flags.
+const defaultRuleName = "default"
+
+// The severities which a rule can have.
+const (
+	severityInfo    = "info"
+	severityWarning = "warning"
+	severityError   = "error"
+)
+
+// config is the content of a rules configuration file.
+type config struct {
+	Rules []ruleConfig `json:"rules"`
+}
+
+// ruleConfig is a rule as it's defined in the configuration file.
+type ruleConfig struct {
+	Name        string   `json:"name"`
+	Funcs       []string `json:"funcs"`
+	Sub         uint     `json:"sub"`
+	Promoted    bool     `json:"promoted"`
+	Refs        bool     `json:"refs"`
+	Indirect    bool     `json:"indirect"`
+	Description string   `json:"description"`
+	Severity    string   `json:"severity"`
+	Include     []string `json:"include"`
+	Exclude     []string `json:"exclude"`
+	Message     string   `json:"message"`
+}
+
+// rule is a named query of function calls.
+type rule struct {
+	name        string
+	description string
+	severity    string
+	funcCalls   []funcCall
+	subsetsOf   uint
+	// promoted indicates that the calls to the methods promoted through
+	// embedded fields also match the funcCalls of the embedding type.
+	promoted bool
+	// refs indicates that the references to the funcCalls which aren't calls
+	// also match.
+	refs bool
+	// indirect indicates that the calls through function values also match
+	// the funcCalls which they may call.
+	indirect bool
+	// include is the list of package patterns which the rule is applied to. An
+	// empty list means all the packages.
+	include []string
+	// exclude is the list of package patterns which the rule isn't applied to.
+	exclude []string
+	// message is the template used for reporting the functions which match the
+	// rule. It's nil when the rule doesn't have any message.
+	message *template.Template
+}
+
+// messageData is the data passed to the message template of a rule.
+type messageData struct {
+	Rule           string
+	Description    string
+	Severity       string
+	Package        string
+	Module         string
+	Filename       string
+	ModuleFilename string
+	Func           string
+	FullName       string
+}
+
+// appliesTo returns true if the rule must be applied to the package with the
+// pkgPath import path.
+func (r rule) appliesTo(pkgPath string) bool {
+	for _, p := range r.exclude {
+		if matchPkgPattern(p, pkgPath) {
+			return false
+		}
+	}
+
+	if len(r.include) == 0 {
+		return true
+	}
+
+	for _, p := range r.include {
+		if matchPkgPattern(p, pkgPath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// indirectRules returns true if any of rules matches the calls through
+// function values, which requires resolving them when indexing the packages.
+func indirectRules(rules []rule) bool {
+	for _, r := range rules {
+		if r.indirect {
+			return true
+		}
+	}
+
+	return false
+}
+
+// formatMessage returns the message of the rule for the function fr. It
+// returns an empty string if the rule doesn't have a message.
+func (r rule) formatMessage(fr funcResult) (string, error) {
+	if r.message == nil {
+		return "", nil
+	}
+
+	var sb strings.Builder
+	err := r.message.Execute(&sb, messageData{
+		Rule:           r.name,
+		Description:    r.description,
+		Severity:       r.severity,
+		Package:        fr.Package,
+		Module:         fr.Module,
+		Filename:       fr.Filename,
+		ModuleFilename: fr.ModuleFilename,
+		Func:           fr.Func,
+		FullName:       fr.FullName,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error while formatting message of rule %q: %v", r.name, err)
+	}
+
+	return sb.String(), nil
+}
+
+// readConfig reads the rules configuration file filename.
+func readConfig(filename string) ([]rule, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening configuration file: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	rules, err := parseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v. Configuration file: %s", err, filename)
+	}
+
+	return rules, nil
+}
+
+// parseConfig decodes the JSON rules configuration read from r and validates
+// each rule.
+func parseConfig(r io.Reader) ([]rule, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var cfg config
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	if len(cfg.Rules) == 0 {
+		return nil, errors.New("invalid configuration: it doesn't have any rule")
+	}
+
+	var (
+		names = make(map[string]bool, len(cfg.Rules))
+		rules = make([]rule, len(cfg.Rules))
+	)
+	for i, rc := range cfg.Rules {
+		if names[rc.Name] {
+			return nil, fmt.Errorf("invalid configuration: duplicated rule name %q", rc.Name)
+		}
+		names[rc.Name] = true
+
+		r, err := rc.rule()
+		if err != nil {
+			return nil, err
+		}
+
+		rules[i] = r
+	}
+
+	return rules, nil
+}
+
+// rule validates rc and converts it to a rule.
+func (rc ruleConfig) rule() (rule, error) {
+	if rc.Name == "" || strings.ContainsAny(rc.Name, " \t\n") {
+		return rule{}, fmt.Errorf(
+			"invalid rule name %q, it cannot be empty nor contain spaces", rc.Name,
+		)
+	}
+
+	if len(rc.Funcs) == 0 {
+		return rule{}, fmt.Errorf("invalid rule %q: funcs cannot be empty", rc.Name)
+	}
+
+	fcalls, err := parseFuncCalls(strings.Join(rc.Funcs, ","))
+	if err != nil {
+		return rule{}, fmt.Errorf("invalid rule %q: %v", rc.Name, err)
+	}
+
+	severity := rc.Severity
+	switch severity {
+	case "":
+		severity = severityWarning
+	case severityInfo, severityWarning, severityError:
+	default:
+		return rule{}, fmt.Errorf(
+			"invalid rule %q: unknown severity %q, valid ones are: %s, %s, %s",
+			rc.Name, rc.Severity, severityInfo, severityWarning, severityError,
+		)
+	}
+
+	var msg *template.Template
+	if rc.Message != "" {
+		msg, err = template.New(rc.Name).Option("missingkey=error").Parse(rc.Message)
+		if err != nil {
+			return rule{}, fmt.Errorf("invalid rule %q: invalid message template: %v", rc.Name, err)
+		}
+	}
+
+	return rule{
+		name:        rc.Name,
+		description: rc.Description,
+		severity:    severity,
+		funcCalls:   fcalls,
+		subsetsOf:   rc.Sub,
+		promoted:    rc.Promoted,
+		refs:        rc.Refs,
+		indirect:    rc.Indirect,
+		include:     rc.Include,
+		exclude:     rc.Exclude,
+		message:     msg,
+	}, nil
+}
+
+// matchPkgPattern returns true if pkgPath matches pattern. The pattern follows
+// the same rules than the go command package patterns, hence "..." matches any
+// string and "net/..." matches "net" and its subdirectories.
+func matchPkgPattern(pattern string, pkgPath string) bool {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.ReplaceAll(re, `\.\.\.`, `.*`)
+	if strings.HasSuffix(re, `/.*`) {
+		re = strings.TrimSuffix(re, `/.*`) + `(/.*)?`
+	}
+
+	matched, _ := regexp.MatchString("^"+re+"$", pkgPath)
+	return matched
+}
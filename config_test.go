@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	tcases := []struct {
+		name    string
+		in      string
+		isError bool
+	}{
+		{
+			name:    "error: invalid JSON",
+			in:      `{"rules": [`,
+			isError: true,
+		},
+		{
+			name:    "error: unknown field",
+			in:      `{"rules": [{"name": "a", "funcs": ["strings.Compare"], "unknown": 1}]}`,
+			isError: true,
+		},
+		{
+			name:    "error: without rules",
+			in:      `{"rules": []}`,
+			isError: true,
+		},
+		{
+			name:    "error: rule without name",
+			in:      `{"rules": [{"funcs": ["strings.Compare"]}]}`,
+			isError: true,
+		},
+		{
+			name:    "error: rule name with spaces",
+			in:      `{"rules": [{"name": "a b", "funcs": ["strings.Compare"]}]}`,
+			isError: true,
+		},
+		{
+			name: "error: duplicated rule name",
+			in: `{"rules": [
+				{"name": "a", "funcs": ["strings.Compare"]},
+				{"name": "a", "funcs": ["bytes.Compare"]}
+			]}`,
+			isError: true,
+		},
+		{
+			name:    "error: rule without funcs",
+			in:      `{"rules": [{"name": "a"}]}`,
+			isError: true,
+		},
+		{
+			name:    "error: rule with invalid funcs",
+			in:      `{"rules": [{"name": "a", "funcs": ["net/http"]}]}`,
+			isError: true,
+		},
+		{
+			name:    "error: rule with unknown severity",
+			in:      `{"rules": [{"name": "a", "funcs": ["strings.Compare"], "severity": "fatal"}]}`,
+			isError: true,
+		},
+		{
+			name:    "error: rule with invalid message template",
+			in:      `{"rules": [{"name": "a", "funcs": ["strings.Compare"], "message": "{{.Func"}]}`,
+			isError: true,
+		},
+		{
+			name: "ok",
+			in: `{"rules": [
+				{"name": "a", "funcs": ["strings.Compare", "bytes.Buffer.Bytes"], "sub": 1},
+				{"name": "b", "funcs": ["bytes.Compare"], "severity": "error", "message": "{{.Func}}", "promoted": true, "refs": true, "indirect": true}
+			]}`,
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := parseConfig(strings.NewReader(tc.in))
+			if tc.isError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, rules, 2)
+
+			assert.Equal(t, "a", rules[0].name)
+			assert.Equal(t, severityWarning, rules[0].severity)
+			assert.Equal(t, uint(1), rules[0].subsetsOf)
+			assert.Equal(t, []funcCall{
+				{pkg: "strings", funcName: "Compare"},
+				{pkg: "bytes", receiver: "Buffer", funcName: "Bytes"},
+			}, rules[0].funcCalls)
+			assert.Nil(t, rules[0].message)
+			assert.False(t, rules[0].promoted)
+			assert.False(t, rules[0].refs)
+			assert.False(t, rules[0].indirect)
+
+			assert.Equal(t, "b", rules[1].name)
+			assert.Equal(t, severityError, rules[1].severity)
+			assert.NotNil(t, rules[1].message)
+			assert.True(t, rules[1].promoted)
+			assert.True(t, rules[1].refs)
+			assert.True(t, rules[1].indirect)
+		})
+	}
+}
+
+func TestRuleAppliesTo(t *testing.T) {
+	r := rule{
+		include: []string{"example.com/a/...", "example.com/b"},
+		exclude: []string{"example.com/a/internal/..."},
+	}
+
+	assert.True(t, r.appliesTo("example.com/a"))
+	assert.True(t, r.appliesTo("example.com/a/x/y"))
+	assert.True(t, r.appliesTo("example.com/b"))
+	assert.False(t, r.appliesTo("example.com/b/x"))
+	assert.False(t, r.appliesTo("example.com/ab"))
+	assert.False(t, r.appliesTo("example.com/a/internal"))
+	assert.False(t, r.appliesTo("example.com/a/internal/x"))
+	assert.False(t, r.appliesTo("example.com/c"))
+
+	assert.True(t, rule{}.appliesTo("example.com/c"))
+}
+
+func TestRunConfig(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{
+		"-config", "testdata/rules.json",
+		"github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/testpkg",
+	}, &stdout, &stderr)
+	require.Equal(t, exitCodeOK, code, "stderr: %s", stderr.String())
+
+	out := stdout.String()
+	assert.Contains(t, out,
+		"testdata/testpkg/impl.go:12:1: unexportedFunc: cookies[error]: unexportedFunc reads cookies: cookies are read from a jar\n",
+	)
+	assert.Contains(t, out, "testdata/testpkg/impl.go:75:1: ExportedType.ExportedMethod: join-and-compare[info]\n")
+	assert.NotContains(t, out, "excluded")
+}
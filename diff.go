@@ -0,0 +1,181 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// lineRange is a range of lines, both included. A range whose to is lower than
+// from represents the lines deleted between the lines to and from.
+type lineRange struct {
+	from int
+	to   int
+}
+
+// intersects returns true if lr intersects with the range of lines from start
+// to end, both included.
+func (lr lineRange) intersects(start, end int) bool {
+	return lr.from <= end && lr.to >= start
+}
+
+// diffLines maps the absolute paths of the files changed by a diff to their
+// changed lines, in the new version of the files.
+type diffLines map[string][]lineRange
+
+// funcFilter returns a filter which keeps the functions whose declarations,
+// including their documentation, intersect with the changed lines. The lines
+// are the ones of the files on disk, because the diffs aren't adjusted by the
+// //line directives.
+func (dl diffLines) funcFilter() funcFilter {
+	return func(fi *fileIndex, fn *funcIndex) bool {
+		for _, lr := range dl[filepath.Clean(fi.Filename)] {
+			if lr.intersects(fn.FromLine, fn.ToLine) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// gitDiffLines returns the lines changed in the working tree of the git
+// repository which contains dir since the revision rev.
+func gitDiffLines(dir string, rev string) (diffLines, error) {
+	root, err := gitRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := gitOutput(
+		root, "diff", "--no-color", "--no-ext-diff", "-U0", "--src-prefix=a/", "--dst-prefix=b/", rev, "--",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseUnifiedDiff(strings.NewReader(out), root)
+}
+
+// readDiffLines reads a unified diff from r and returns its changed lines. The
+// paths of the diff are relative to the root of the git repository which
+// contains dir or to dir if it isn't in a git repository.
+func readDiffLines(r io.Reader, dir string) (diffLines, error) {
+	root, err := gitRoot(dir)
+	if err != nil {
+		root, err = filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return parseUnifiedDiff(r, root)
+}
+
+// gitRoot returns the absolute path of the root of the git repository which
+// contains dir.
+func gitRoot(dir string) (string, error) {
+	out, err := gitOutput(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(out), nil
+}
+
+// gitOutput runs git with args in dir and returns its standard output.
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("error while running git %s: %v. %s",
+			strings.Join(args, " "), err, strings.TrimSpace(stderr.String()),
+		)
+	}
+
+	return string(out), nil
+}
+
+// hunkHeader matches the header of a unified diff hunk and captures the start
+// and the optional number of lines of the new version.
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// parseUnifiedDiff parses the unified diff read from r and returns the changed
+// lines of each file. The paths of the diff are joined to root.
+func parseUnifiedDiff(r io.Reader, root string) (diffLines, error) {
+	var (
+		dl      = diffLines{}
+		scanner = bufio.NewScanner(r)
+		file    string
+	)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			name := strings.TrimPrefix(line, "+++ ")
+			if i := strings.IndexByte(name, '\t'); i >= 0 {
+				name = name[:i]
+			}
+
+			if name == "/dev/null" {
+				// the file has been deleted
+				file = ""
+				continue
+			}
+
+			name = strings.TrimPrefix(name, "b/")
+			file = filepath.Clean(filepath.Join(root, name))
+
+		case strings.HasPrefix(line, "@@ "):
+			if file == "" {
+				continue
+			}
+
+			m := hunkHeader.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("invalid unified diff hunk header: %q", line)
+			}
+
+			start, err := strconv.Atoi(m[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid unified diff hunk header: %q. %v", line, err)
+			}
+
+			count := 1
+			if m[2] != "" {
+				count, err = strconv.Atoi(m[2])
+				if err != nil {
+					return nil, fmt.Errorf("invalid unified diff hunk header: %q. %v", line, err)
+				}
+			}
+
+			lr := lineRange{from: start, to: start + count - 1}
+			if count == 0 {
+				// the lines have been deleted after the line start
+				lr = lineRange{from: start + 1, to: start}
+			}
+
+			dl[file] = append(dl[file], lr)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error while reading unified diff: %v", err)
+	}
+
+	return dl, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUnifiedDiff(t *testing.T) {
+	const diff = `diff --git a/a.go b/a.go
+index 1111111..2222222 100644
+--- a/a.go
++++ b/a.go
+@@ -3 +3 @@ package a
+-old
++new
+@@ -10,0 +11,3 @@ func F() {
++added
++added
++added
+@@ -20,2 +23,0 @@ func G() {
+-deleted
+-deleted
+diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package a
+-
+diff --git a/dir/new.go b/dir/new.go
+new file mode 100644
+--- /dev/null
++++ b/dir/new.go
+@@ -0,0 +1,2 @@
++package dir
++
+`
+
+	dl, err := parseUnifiedDiff(strings.NewReader(diff), "/root")
+	require.NoError(t, err)
+	assert.Equal(t, diffLines{
+		"/root/a.go": []lineRange{
+			{from: 3, to: 3},
+			{from: 11, to: 13},
+			{from: 24, to: 23},
+		},
+		"/root/dir/new.go": []lineRange{{from: 1, to: 2}},
+	}, dl)
+
+	_, err = parseUnifiedDiff(strings.NewReader("+++ b/a.go\n@@ invalid @@\n"), "/root")
+	require.Error(t, err)
+}
+
+func TestLineRangeIntersects(t *testing.T) {
+	tcases := []struct {
+		name       string
+		lr         lineRange
+		start, end int
+		expected   bool
+	}{
+		{name: "before", lr: lineRange{from: 1, to: 4}, start: 5, end: 10, expected: false},
+		{name: "after", lr: lineRange{from: 11, to: 12}, start: 5, end: 10, expected: false},
+		{name: "overlaps start", lr: lineRange{from: 3, to: 5}, start: 5, end: 10, expected: true},
+		{name: "overlaps end", lr: lineRange{from: 10, to: 15}, start: 5, end: 10, expected: true},
+		{name: "inside", lr: lineRange{from: 6, to: 7}, start: 5, end: 10, expected: true},
+		{name: "deletion inside", lr: lineRange{from: 6, to: 5}, start: 5, end: 10, expected: true},
+		{name: "deletion before", lr: lineRange{from: 5, to: 4}, start: 5, end: 10, expected: false},
+		{name: "deletion after", lr: lineRange{from: 11, to: 10}, start: 5, end: 10, expected: false},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.lr.intersects(tc.start, tc.end))
+		})
+	}
+}
+
+func TestFindDiff(t *testing.T) {
+	const diff = `--- a/testdata/testpkg/impl.go
++++ b/testdata/testpkg/impl.go
+@@ -15 +15 @@ func unexportedFunc() {
+-		buf.Reset()
++		buf.Reset()
+`
+
+	dl, err := readDiffLines(strings.NewReader(diff), ".")
+	require.NoError(t, err)
+
+	idxs, _, err := loadIndexes("", []string{"github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/testpkg"}, "", indexOptions{}, 0)
+	require.NoError(t, err)
+
+	fcalls, err := parseFuncCalls("net/http/cookiejar.Jar.Cookies")
+	require.NoError(t, err)
+
+	list := findRule(idxs, rule{funcCalls: fcalls}, nil, findOptions{keepFunc: dl.funcFilter()})
+	require.Len(t, list, 1)
+	assert.Equal(t, []string{"unexportedFunc"}, list[0].FuncNames)
+
+	t.Run("documentation", func(t *testing.T) {
+		const diff = `--- a/testdata/testpkg/impl.go
++++ b/testdata/testpkg/impl.go
+@@ -26 +26 @@ func unexportedFunc() {
+-// ExportedFunc ...
++// ExportedFunc ...
+`
+
+		dl, err := readDiffLines(strings.NewReader(diff), ".")
+		require.NoError(t, err)
+
+		fcalls, err := parseFuncCalls("fmt.Println")
+		require.NoError(t, err)
+
+		list := findRule(idxs, rule{funcCalls: fcalls}, nil, findOptions{keepFunc: dl.funcFilter()})
+		require.Len(t, list, 1)
+		assert.Equal(t, []string{"ExportedFunc"}, list[0].FuncNames)
+	})
+
+	t.Run("line directives", func(t *testing.T) {
+		const diff = `--- a/testdata/linedir/gen.go
++++ b/testdata/linedir/gen.go
+@@ -9 +9 @@ func templated() {
+-	strings.Compare("a", "b")
++	strings.Compare("a", "b")
+`
+
+		dl, err := readDiffLines(strings.NewReader(diff), ".")
+		require.NoError(t, err)
+
+		idxs, _, err := loadIndexes("", []string{"github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/linedir"}, "", indexOptions{}, 0)
+		require.NoError(t, err)
+
+		fcalls, err := parseFuncCalls("strings.Compare")
+		require.NoError(t, err)
+
+		list := findRule(idxs, rule{funcCalls: fcalls}, nil, findOptions{keepFunc: dl.funcFilter()})
+		require.Len(t, list, 1)
+		assert.Equal(t, []string{"templated"}, list[0].FuncNames)
+	})
+}
+
+func TestGitDiffLines(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	filename := filepath.Join(dir, "a.go")
+	require.NoError(t, os.WriteFile(filename, []byte("package a\n\nfunc F() {\n}\n"), 0644))
+	git("init", "-q")
+	git("add", "a.go")
+	git("commit", "-q", "-m", "initial")
+
+	require.NoError(t, os.WriteFile(filename, []byte("package a\n\nfunc F() {\n\tprintln()\n}\n"), 0644))
+
+	dl, err := gitDiffLines(dir, "HEAD")
+	require.NoError(t, err)
+
+	root, err := gitRoot(dir)
+	require.NoError(t, err)
+	assert.Equal(t, diffLines{
+		filepath.Join(root, "a.go"): []lineRange{{from: 4, to: 4}},
+	}, dl)
+
+	_, err = gitDiffLines(dir, "unknown-revision")
+	require.Error(t, err)
+}
@@ -0,0 +1,135 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The modes of handling the generated files.
+const (
+	// generatedSkip doesn't analyze the generated files.
+	generatedSkip = "skip"
+	// generatedInclude analyzes the generated files as any other file.
+	generatedInclude = "include"
+	// generatedOnly only analyzes the generated files.
+	generatedOnly = "only"
+)
+
+// fileFilter reports if the file fi must be analyzed.
+type fileFilter func(fi *fileIndex) bool
+
+// newFileFilter returns a filter which keeps the files according to the
+// generated mode and discards the ones which match any of the exclude
+// patterns. It returns nil when all the files must be kept.
+//
+// It returns an error if generated isn't a valid mode or any of the exclude
+// patterns is malformed.
+func newFileFilter(generated string, exclude []string) (fileFilter, error) {
+	switch generated {
+	case generatedSkip, generatedInclude, generatedOnly:
+	default:
+		return nil, fmt.Errorf(
+			"invalid generated value %q, valid ones are: %s, %s, %s",
+			generated, generatedSkip, generatedInclude, generatedOnly,
+		)
+	}
+
+	for _, p := range exclude {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %v", p, err)
+		}
+	}
+
+	if generated == generatedInclude && len(exclude) == 0 {
+		return nil, nil
+	}
+
+	return func(fi *fileIndex) bool {
+		switch generated {
+		case generatedSkip:
+			if fi.Generated {
+				return false
+			}
+		case generatedOnly:
+			if !fi.Generated {
+				return false
+			}
+		}
+
+		for _, p := range exclude {
+			if matchFilePattern(p, fi.sourceFile) {
+				return false
+			}
+		}
+
+		return true
+	}, nil
+}
+
+// isGeneratedFile returns true if file has the standard comment which marks
+// the generated files, i.e. "// Code generated ... DO NOT EDIT.". The files
+// generated by cgo aren't considered generated because they are reported as
+// their original file.
+func isGeneratedFile(sf sourceFile, file *ast.File) bool {
+	return !sf.Cgo && ast.IsGenerated(file)
+}
+
+// matchFilePattern returns true if the file sf matches pattern. A pattern
+// without any slash is matched against the base name of the file, otherwise
+// against the module relative path of the file, or its absolute path when the
+// pattern is absolute or the file doesn't have a module relative path.
+//
+// The patterns have the syntax of path.Match, besides "**" which matches zero
+// or more directories.
+func matchFilePattern(pattern string, sf sourceFile) bool {
+	filename := filepath.ToSlash(sf.Filename)
+	if !strings.Contains(pattern, "/") {
+		return matchPathPattern(pattern, path.Base(filename))
+	}
+
+	if sf.ModuleFilename != "" && !path.IsAbs(pattern) {
+		return matchPathPattern(pattern, sf.ModuleFilename)
+	}
+
+	return matchPathPattern(pattern, filename)
+}
+
+// matchPathPattern returns true if the slash separated name matches pattern.
+// Each element of pattern is matched with path.Match against each element of
+// name, except "**" which matches zero or more elements.
+func matchPathPattern(pattern string, name string) bool {
+	var match func(pelems []string, nelems []string) bool
+	match = func(pelems []string, nelems []string) bool {
+		for len(pelems) > 0 {
+			if pelems[0] == "**" {
+				for i := 0; i <= len(nelems); i++ {
+					if match(pelems[1:], nelems[i:]) {
+						return true
+					}
+				}
+
+				return false
+			}
+
+			if len(nelems) == 0 {
+				return false
+			}
+
+			if ok, _ := path.Match(pelems[0], nelems[0]); !ok {
+				return false
+			}
+
+			pelems, nelems = pelems[1:], nelems[1:]
+		}
+
+		return len(nelems) == 0
+	}
+
+	return match(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
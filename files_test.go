@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchFilePattern(t *testing.T) {
+	sf := sourceFile{
+		Filename:       "/src/mod/internal/api/mocks/client_mock.go",
+		ModuleFilename: "internal/api/mocks/client_mock.go",
+	}
+
+	tcases := []struct {
+		pattern  string
+		expected bool
+	}{
+		{pattern: "*_mock.go", expected: true},
+		{pattern: "*.pb.go", expected: false},
+		{pattern: "internal/api/mocks/*.go", expected: true},
+		{pattern: "internal/*/mocks/*.go", expected: true},
+		{pattern: "**/mocks/*", expected: true},
+		{pattern: "internal/**/*_mock.go", expected: true},
+		{pattern: "**/client_mock.go", expected: true},
+		{pattern: "mocks/*.go", expected: false},
+		{pattern: "internal/**/api", expected: false},
+		{pattern: "/src/mod/**/*.go", expected: true},
+		{pattern: "/src/other/**", expected: false},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.pattern, func(t *testing.T) {
+			assert.Equal(t, tc.expected, matchFilePattern(tc.pattern, sf))
+		})
+	}
+}
+
+func TestIsGeneratedFile(t *testing.T) {
+	parse := func(src string) *ast.File {
+		f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ParseComments)
+		require.NoError(t, err)
+		return f
+	}
+
+	var (
+		generated = parse("// Code generated by mockgen. DO NOT EDIT.\n\npackage p\n")
+		handmade  = parse("// Package p does things.\npackage p\n")
+		sf        = sourceFile{Filename: "/src/p/p.go"}
+	)
+
+	assert.True(t, isGeneratedFile(sf, generated))
+	assert.False(t, isGeneratedFile(sf, handmade))
+	assert.False(t, isGeneratedFile(sourceFile{Filename: "/src/p/p.go", Cgo: true}, generated))
+}
+
+func TestNewFileFilter(t *testing.T) {
+	var (
+		generated = &fileIndex{
+			sourceFile: sourceFile{Filename: "/src/p/p.pb.go", ModuleFilename: "p/p.pb.go"},
+			Generated:  true,
+		}
+		handmade = &fileIndex{
+			sourceFile: sourceFile{Filename: "/src/p/p.go", ModuleFilename: "p/p.go"},
+		}
+	)
+
+	t.Run("include", func(t *testing.T) {
+		keep, err := newFileFilter(generatedInclude, nil)
+		require.NoError(t, err)
+		assert.Nil(t, keep)
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		keep, err := newFileFilter(generatedSkip, nil)
+		require.NoError(t, err)
+		assert.False(t, keep(generated))
+		assert.True(t, keep(handmade))
+	})
+
+	t.Run("only", func(t *testing.T) {
+		keep, err := newFileFilter(generatedOnly, nil)
+		require.NoError(t, err)
+		assert.True(t, keep(generated))
+		assert.False(t, keep(handmade))
+	})
+
+	t.Run("exclude", func(t *testing.T) {
+		keep, err := newFileFilter(generatedInclude, []string{"*_test.go", "p/*.go"})
+		require.NoError(t, err)
+		assert.False(t, keep(handmade))
+		assert.True(t, keep(&fileIndex{sourceFile: sourceFile{Filename: "/src/q/q.go", ModuleFilename: "q/q.go"}}))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := newFileFilter("none", nil)
+		require.Error(t, err)
+
+		_, err = newFileFilter(generatedInclude, []string{"[a-"})
+		require.Error(t, err)
+	})
+}
+
+func TestRunGenerated(t *testing.T) {
+	const pkg = "github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/generated"
+
+	tcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name: "include",
+			args: nil,
+			expected: "testdata/generated/color.go:7:1: color.code: default[warning]\n" +
+				"testdata/generated/color_mock.go:5:1: mockColorCode: default[warning]\n" +
+				"testdata/generated/gen.go:7:1: color.String: default[warning] (generated) (suppressed)\n",
+		},
+		{
+			name: "skip",
+			args: []string{"-generated", generatedSkip},
+			expected: "testdata/generated/color.go:7:1: color.code: default[warning]\n" +
+				"testdata/generated/color_mock.go:5:1: mockColorCode: default[warning]\n",
+		},
+		{
+			name:     "only",
+			args:     []string{"-generated", generatedOnly},
+			expected: "testdata/generated/gen.go:7:1: color.String: default[warning] (generated) (suppressed)\n",
+		},
+		{
+			name:     "skip and exclude",
+			args:     []string{"-generated", generatedSkip, "-exclude-files", "*_mock.go"},
+			expected: "testdata/generated/color.go:7:1: color.code: default[warning]\n",
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			// the suppression of gen.go isn't reported as unused when it's
+			// skipped
+			args := append(tc.args, "-report-suppressed", "-funcs", "strconv.Itoa", pkg)
+
+			var stdout, stderr bytes.Buffer
+			code := run(args, &stdout, &stderr)
+			require.Equal(t, exitCodeOK, code, "stderr: %s", stderr.String())
+			assert.Equal(t, tc.expected, stdout.String())
+			assert.Empty(t, stderr.String())
+		})
+	}
+}
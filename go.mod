@@ -1,9 +1,20 @@
 module github.com/ifraixedes/find-funcs-with-set-funcs-calls
 
-go 1.13
+go 1.22.0
 
 require (
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/stretchr/testify v1.4.0
-	github.com/zeebo/assert v1.0.0
-	golang.org/x/tools v0.0.0-20191018212557-ed542cd5b28a
+	golang.org/x/term v0.29.0
+	golang.org/x/tools v0.30.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/mod v0.23.0 // indirect
+	golang.org/x/sync v0.11.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
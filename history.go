@@ -0,0 +1,381 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// historyCmd is the name of the subcommand which reports the history of the
+// matches across git revisions.
+const historyCmd = "history"
+
+type historyParams struct {
+	pkgsPatterns []string
+	rules        []rule
+	// revs is the list of revisions to analyze. It's empty when every is used.
+	revs []string
+	// every indicates to analyze every Nth commit of revRange.
+	every    uint
+	revRange string
+	format   string
+}
+
+// parseHistoryParams parses and maps the command line flags and arguments of
+// the history subcommand. inParams is the list of command line arguments
+// after the subcommand name.
+func parseHistoryParams(inParams []string) (historyParams, error) {
+	fset := flag.NewFlagSet(historyCmd, flag.ContinueOnError)
+	qflags := addQueryFlags(fset)
+	revs := fset.String("revs", "",
+		"comma separated list of the git revisions to analyze, from the oldest to the newest",
+	)
+	every := fset.Uint("every", 0,
+		"analyze every Nth commit of the range. The newest commit of the range is always analyzed",
+	)
+	revRange := fset.String("range", "HEAD",
+		"the git revision range whose commits are analyzed when every is set, e.g. v1.0.0..HEAD",
+	)
+	format := fset.String("format", formatCSV,
+		fmt.Sprintf("the output format: %s or %s", formatCSV, formatJSON),
+	)
+
+	if err := fset.Parse(inParams); err != nil {
+		return historyParams{}, err
+	}
+
+	if (*revs == "") == (*every == 0) {
+		return historyParams{}, errors.New("one, and only one, of revs or every arguments is required")
+	}
+
+	if *format != formatCSV && *format != formatJSON {
+		return historyParams{}, fmt.Errorf(
+			"invalid format %q, valid ones are: %s, %s", *format, formatCSV, formatJSON,
+		)
+	}
+
+	rules, err := qflags.rules()
+	if err != nil {
+		return historyParams{}, err
+	}
+
+	var revList []string
+	if *revs != "" {
+		for _, r := range strings.Split(*revs, ",") {
+			if r = strings.TrimSpace(r); r != "" {
+				revList = append(revList, r)
+			}
+		}
+	}
+
+	return historyParams{
+		pkgsPatterns: fset.Args(),
+		rules:        rules,
+		revs:         revList,
+		every:        *every,
+		revRange:     *revRange,
+		format:       *format,
+	}, nil
+}
+
+// history is the evolution of the functions which match a set of rules across
+// git revisions.
+type history struct {
+	Series []historyPoint `json:"series"`
+	Funcs  []historyFunc  `json:"funcs"`
+	// Failed are the revisions whose packages have errors, e.g. they don't
+	// type check, which are excluded from Series and Funcs because their
+	// matches would be incomplete.
+	Failed []historyFailure `json:"failed,omitempty"`
+}
+
+// historyPoint is the number of functions which match a rule in a revision.
+type historyPoint struct {
+	Revision string `json:"revision"`
+	Date     string `json:"date"`
+	Rule     string `json:"rule"`
+	Matches  int    `json:"matches"`
+}
+
+// historyFunc is a function which matches a rule and the first analyzed
+// revision where it matched.
+type historyFunc struct {
+	Rule      string `json:"rule"`
+	Package   string `json:"package"`
+	Func      string `json:"func"`
+	FirstSeen string `json:"first_seen"`
+}
+
+// historyFailure is a revision which couldn't be analyzed.
+type historyFailure struct {
+	Revision string `json:"revision"`
+	Date     string `json:"date"`
+	Error    string `json:"error"`
+}
+
+// packagesErrors are the errors of some loaded packages.
+type packagesErrors []packages.Error
+
+func (pe packagesErrors) Error() string {
+	if len(pe) == 1 {
+		return fmt.Sprintf("package error: %s", pe[0])
+	}
+
+	return fmt.Sprintf("package error: %s (and %d more)", pe[0], len(pe)-1)
+}
+
+// runHistory executes the history subcommand with args, which are the command
+// line arguments after the subcommand name, and returns the exit code.
+func runHistory(args []string, stdout io.Writer, stderr io.Writer) int {
+	hp, err := parseHistoryParams(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitCodeOK
+		}
+
+		fmt.Fprintln(stderr, err)
+		return exitCodeUsage
+	}
+
+	revs := hp.revs
+	if hp.every > 0 {
+		revs, err = gitEveryNthCommit(".", hp.revRange, hp.every)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitCodeError
+		}
+	}
+
+	hist, err := collectHistory(".", revs, hp.rules, hp.pkgsPatterns)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitCodeError
+	}
+
+	for _, f := range hist.Failed {
+		fmt.Fprintf(stderr, "warning: revision %s skipped: %s\n", f.Revision, f.Error)
+	}
+
+	if hp.format == formatJSON {
+		err = writeHistoryJSON(stdout, hist)
+	} else {
+		err = writeHistoryCSV(stdout, hist)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitCodeError
+	}
+
+	return exitCodeOK
+}
+
+// collectHistory applies rules to the packages which match pkgsPatterns in each
+// of the revs of the git repository which contains dir. Each revision is
+// checked out in a temporary git worktree. pkgsPatterns are relative to the
+// same directory than dir is relative to the repository root. The revisions
+// whose packages have errors are reported in the Failed field.
+func collectHistory(dir string, revs []string, rules []rule, pkgsPatterns []string) (history, error) {
+	root, err := gitRoot(dir)
+	if err != nil {
+		return history{}, err
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return history{}, err
+	}
+
+	relDir, err := filepath.Rel(root, absDir)
+	if err != nil {
+		return history{}, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "findfuncs-history-")
+	if err != nil {
+		return history{}, fmt.Errorf("error while creating temporary directory: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	var (
+		hist      history
+		firstSeen = map[baselineEntry]string{}
+	)
+	for i, rev := range revs {
+		hash, date, err := gitCommitInfo(root, rev)
+		if err != nil {
+			return history{}, err
+		}
+
+		wtDir := filepath.Join(tmpDir, strconv.Itoa(i))
+		results, err := findInRevision(root, wtDir, relDir, hash, rules, pkgsPatterns)
+		if err != nil {
+			var pe packagesErrors
+			if errors.As(err, &pe) {
+				hist.Failed = append(hist.Failed, historyFailure{Revision: hash, Date: date, Error: pe.Error()})
+				continue
+			}
+
+			return history{}, fmt.Errorf("%v. Revision: %s", err, rev)
+		}
+
+		for _, rr := range results {
+			hist.Series = append(hist.Series, historyPoint{
+				Revision: hash,
+				Date:     date,
+				Rule:     rr.rule.name,
+				Matches:  countMatches(rr.funcsFiles),
+			})
+		}
+
+		for _, e := range newBaseline(results).Entries {
+			if _, ok := firstSeen[e]; !ok {
+				firstSeen[e] = hash
+			}
+		}
+	}
+
+	var entries []baselineEntry
+	for e := range firstSeen {
+		entries = append(entries, e)
+	}
+
+	sortBaselineEntries(entries)
+	for _, e := range entries {
+		hist.Funcs = append(hist.Funcs, historyFunc{
+			Rule:      e.Rule,
+			Package:   e.Package,
+			Func:      e.Func,
+			FirstSeen: firstSeen[e],
+		})
+	}
+
+	return hist, nil
+}
+
+// findInRevision checks out the commit hash of the git repository in root into
+// the worktree wtDir and applies rules to the packages which match
+// pkgsPatterns relative to the relDir of the worktree. The worktree is removed
+// before returning. It returns a packagesErrors error if any of the packages or
+// their dependencies have errors.
+func findInRevision(
+	root string, wtDir string, relDir string, hash string, rules []rule, pkgsPatterns []string,
+) ([]ruleResult, error) {
+	if _, err := gitOutput(root, "worktree", "add", "--detach", wtDir, hash); err != nil {
+		return nil, err
+	}
+	defer func() { _, _ = gitOutput(root, "worktree", "remove", "--force", wtDir) }()
+
+	pkgs, err := loadPackages(filepath.Join(wtDir, relDir), pkgsPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	var pe packagesErrors
+	packages.Visit(pkgs, nil, func(p *packages.Package) {
+		pe = append(pe, p.Errors...)
+	})
+	if len(pe) > 0 {
+		return nil, pe
+	}
+
+	idxs, err := indexPackages(pkgs, indexOptions{indirect: indirectRules(rules)}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err = resolvePkgNames(rules, idxs, newTypesPackages(pkgs))
+	if err != nil {
+		return nil, err
+	}
+
+	sups, _ := collectSuppressions(idxs, nil)
+	results := make([]ruleResult, len(rules))
+	for i, r := range rules {
+		results[i] = ruleResult{rule: r, funcsFiles: findRule(idxs, r, sups, findOptions{})}
+	}
+
+	return results, nil
+}
+
+// gitEveryNthCommit returns every nth commit of the first parent history of
+// revRange, from the oldest to the newest. The newest commit is always
+// returned.
+func gitEveryNthCommit(dir string, revRange string, n uint) ([]string, error) {
+	out, err := gitOutput(dir, "rev-list", "--reverse", "--first-parent", revRange, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	commits := strings.Fields(out)
+	var selected []string
+	for i, c := range commits {
+		if i%int(n) == 0 || i == len(commits)-1 {
+			selected = append(selected, c)
+		}
+	}
+
+	return selected, nil
+}
+
+// gitCommitInfo returns the hash and the committer date, in strict ISO 8601
+// format, of the commit rev.
+func gitCommitInfo(dir string, rev string) (hash string, date string, _ error) {
+	out, err := gitOutput(dir, "show", "-s", "--format=%H %cI", rev+"^{commit}", "--")
+	if err != nil {
+		return "", "", err
+	}
+
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("unexpected git show output for revision %q: %q", rev, out)
+	}
+
+	return fields[0], fields[1], nil
+}
+
+// writeHistoryJSON writes hist in JSON format to w.
+func writeHistoryJSON(w io.Writer, hist history) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(hist)
+}
+
+// writeHistoryCSV writes hist to w as two CSV tables separated by an empty
+// line: the time series and the functions with the revision where they were
+// first seen.
+func writeHistoryCSV(w io.Writer, hist history) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"revision", "date", "rule", "matches"})
+	for _, p := range hist.Series {
+		_ = cw.Write([]string{p.Revision, p.Date, p.Rule, strconv.Itoa(p.Matches)})
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintln(w); err != nil {
+		return err
+	}
+
+	_ = cw.Write([]string{"rule", "package", "func", "first_seen"})
+	for _, f := range hist.Funcs {
+		_ = cw.Write([]string{f.Rule, f.Package, f.Func, f.FirstSeen})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunHistory(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	commit := func(src string) string {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), []byte(src), 0644))
+		git("add", ".")
+		git("commit", "-q", "-m", "change")
+		return git("rev-parse", "HEAD")
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/hist\n\ngo 1.13\n"), 0644))
+	git("init", "-q")
+	c1 := commit("package hist\n\nfunc F() {}\n")
+	c2 := commit("package hist\n\nimport \"strings\"\n\nfunc F() { strings.Compare(\"a\", \"b\") }\n")
+	c3 := commit("package hist\n\nimport \"strings\"\n\nfunc F() { strings.Compare(\"a\", \"b\") }\n\nfunc G() { strings.Compare(\"a\", \"b\") }\n")
+
+	hist, err := collectHistory(dir, []string{c1, c2, "HEAD"}, []rule{{
+		name:      defaultRuleName,
+		funcCalls: []funcCall{{pkg: "strings", funcName: "Compare"}},
+	}}, []string{"./..."})
+	require.NoError(t, err)
+
+	require.Len(t, hist.Series, 3)
+	for i, expected := range []struct {
+		rev     string
+		matches int
+	}{{c1, 0}, {c2, 1}, {c3, 2}} {
+		assert.Equal(t, expected.rev, hist.Series[i].Revision)
+		assert.Equal(t, defaultRuleName, hist.Series[i].Rule)
+		assert.Equal(t, expected.matches, hist.Series[i].Matches)
+		assert.NotEmpty(t, hist.Series[i].Date)
+	}
+
+	assert.Equal(t, []historyFunc{
+		{Rule: defaultRuleName, Package: "example.com/hist", Func: "F", FirstSeen: c2},
+		{Rule: defaultRuleName, Package: "example.com/hist", Func: "G", FirstSeen: c3},
+	}, hist.Funcs)
+
+	// only the main worktree remains
+	assert.Equal(t, 0, strings.Count(git("worktree", "list"), "\n"))
+
+	t.Run("every commit", func(t *testing.T) {
+		revs, err := gitEveryNthCommit(dir, "HEAD", 2)
+		require.NoError(t, err)
+		assert.Equal(t, []string{c1, c3}, revs)
+
+		revs, err = gitEveryNthCommit(dir, c1+"..HEAD", 1)
+		require.NoError(t, err)
+		assert.Equal(t, []string{c2, c3}, revs)
+	})
+
+	t.Run("output formats", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, writeHistoryCSV(&buf, hist))
+		lines := strings.Split(buf.String(), "\n")
+		require.Len(t, lines, 9)
+		assert.Equal(t, "revision,date,rule,matches", lines[0])
+		assert.True(t, strings.HasPrefix(lines[2], c2+","))
+		assert.True(t, strings.HasSuffix(lines[2], ",default,1"))
+		assert.Equal(t, "", lines[4])
+		assert.Equal(t, "rule,package,func,first_seen", lines[5])
+		assert.Equal(t, "default,example.com/hist,G,"+c3, lines[7])
+
+		buf.Reset()
+		require.NoError(t, writeHistoryJSON(&buf, hist))
+		var decoded history
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+		assert.Equal(t, hist, decoded)
+	})
+
+	t.Run("revision with errors", func(t *testing.T) {
+		c4 := commit("package hist\n\nimport \"strings\"\n\nfunc F() { strings.Compare(\"a\", \"b\") }\n\nfunc G() { undefined() }\n")
+
+		hist, err := collectHistory(dir, []string{c3, c4}, []rule{{
+			name:      defaultRuleName,
+			funcCalls: []funcCall{{pkg: "strings", funcName: "Compare"}},
+		}}, []string{"./..."})
+		require.NoError(t, err)
+
+		require.Len(t, hist.Series, 1)
+		assert.Equal(t, c3, hist.Series[0].Revision)
+		assert.Equal(t, 2, hist.Series[0].Matches)
+
+		require.Len(t, hist.Failed, 1)
+		assert.Equal(t, c4, hist.Failed[0].Revision)
+		assert.NotEmpty(t, hist.Failed[0].Date)
+		assert.Contains(t, hist.Failed[0].Error, "undefined")
+	})
+}
+
+func TestParseHistoryParams(t *testing.T) {
+	_, err := parseHistoryParams([]string{"-funcs", "strings.Compare", "./..."})
+	require.Error(t, err)
+
+	_, err = parseHistoryParams([]string{"-funcs", "strings.Compare", "-revs", "a", "-every", "2", "./..."})
+	require.Error(t, err)
+
+	_, err = parseHistoryParams([]string{"-funcs", "strings.Compare", "-revs", "a", "-format", "xml", "./..."})
+	require.Error(t, err)
+
+	hp, err := parseHistoryParams([]string{"-funcs", "strings.Compare", "-revs", "v1, v2,", "-format", "json", "./..."})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1", "v2"}, hp.revs)
+	assert.Equal(t, formatJSON, hp.format)
+	assert.Equal(t, []string{"./..."}, hp.pkgsPatterns)
+	require.Len(t, hp.rules, 1)
+}
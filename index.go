@@ -0,0 +1,519 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"runtime"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// The kinds of callees, according to how the called function is referenced in
+// the call expression.
+const (
+	// calleeLocal is a call to an identifier, e.g. "f()", hence to a function
+	// of the same package or a builtin.
+	calleeLocal = "local"
+	// calleeImport is a call to a function of an imported package, either
+	// through a selector whose operand is a package name, e.g. "pkg.F()", or
+	// through an identifier of a dot import, e.g. "F()".
+	calleeImport = "import"
+	// calleeMethod is a call to a method of a variable or of a struct field.
+	calleeMethod = "method"
+)
+
+// pkgIndex is the callee index of a package. It holds all the information
+// which is needed for finding the functions which match a set of function
+// calls, so the packages don't have to be loaded again for another query.
+type pkgIndex struct {
+	PkgPath string `json:"pkg_path"`
+	// Module is the path of the module which contains the package. It's empty
+	// if the package doesn't belong to a module.
+	Module string      `json:"module,omitempty"`
+	Files  []fileIndex `json:"files"`
+}
+
+// fileIndex is the callee index of a Go source file.
+type fileIndex struct {
+	sourceFile
+	// Generated indicates that the file has the standard comment which marks
+	// the generated files.
+	Generated bool `json:"generated,omitempty"`
+	// Imports are the import paths of the file.
+	Imports []string `json:"imports,omitempty"`
+	// Directives are the suppression comments of the file.
+	Directives []directive `json:"directives,omitempty"`
+	Funcs      []funcIndex `json:"funcs,omitempty"`
+}
+
+// directive is a comment of a source file.
+type directive struct {
+	Text string `json:"text"`
+	// Pos is the position adjusted by the //line directives.
+	Pos token.Position `json:"pos"`
+}
+
+// funcIndex is the callee index of a function declaration.
+type funcIndex struct {
+	// ID is the identifier of the function as returned by functionIdentifier.
+	ID  string  `json:"id"`
+	Pos funcPos `json:"pos"`
+	// Start and End are the positions, adjusted by the //line directives, of
+	// the beginning and the end of the declaration.
+	Start token.Position `json:"start"`
+	End   token.Position `json:"end"`
+	// DocLine is the line, adjusted by the //line directives, where the
+	// documentation of the function begins. It's 0 when the function isn't
+	// documented.
+	DocLine int `json:"doc_line,omitempty"`
+	// FromLine and ToLine are the lines of the file on disk, not adjusted by
+	// the //line directives, where the declaration, including its
+	// documentation, begins and ends.
+	FromLine int      `json:"from_line"`
+	ToLine   int      `json:"to_line"`
+	Callees  []callee `json:"callees,omitempty"`
+	// Refs are the references to functions of the body which aren't calls, as
+	// returned by refsInBody.
+	Refs []callee `json:"refs,omitempty"`
+}
+
+// callee is a call expression of the body of a function.
+type callee struct {
+	// Kind is calleeLocal, calleeImport or calleeMethod.
+	Kind string `json:"kind"`
+	// Pkg is the package path of the calleeImport and calleeMethod callees and
+	// Receiver is the type name of the receiver of the calleeMethod ones.
+	Pkg      string `json:"pkg,omitempty"`
+	Receiver string `json:"receiver,omitempty"`
+	Name     string `json:"name"`
+	// EmbeddingPkg and EmbeddingReceiver are the package path and the type
+	// name of the operand of the calleeMethod callees whose method is promoted
+	// through an embedded field, e.g. T of "t.Reset()" when T embeds
+	// bytes.Buffer, while Pkg and Receiver are the ones of the type which
+	// declares the method. They are empty for the rest of the callees.
+	EmbeddingPkg      string `json:"embedding_pkg,omitempty"`
+	EmbeddingReceiver string `json:"embedding_receiver,omitempty"`
+	// PointerRecv indicates that the method of a calleeMethod callee is
+	// declared with a pointer receiver.
+	PointerRecv bool `json:"pointer_recv,omitempty"`
+	// Deref indicates that the method of a calleeMethod callee, declared with
+	// a value receiver, is called through a pointer, which is implicitly
+	// dereferenced, e.g. "p.Len()" when p is a *bytes.Buffer.
+	Deref bool `json:"deref,omitempty"`
+	// Indirect indicates that the call is through a function value, e.g. a
+	// variable or a struct field of a function type, which may refer to the
+	// function, according to indirectCalls.
+	Indirect bool `json:"indirect,omitempty"`
+	// Pos is the position, adjusted by the //line directives, of the call.
+	Pos token.Position `json:"pos"`
+}
+
+// matches returns true if c is a call to fnCall. pkgPath is the path of the
+// package of the function which contains c.
+func (c callee) matches(fnCall funcCall, pkgPath string) bool {
+	switch c.Kind {
+	case calleeLocal:
+		return fnCall.pkg == pkgPath && fnCall.receiver == "" && fnCall.funcName == c.Name
+	case calleeImport:
+		return fnCall.pkg == c.Pkg && fnCall.receiver == "" && fnCall.funcName == c.Name
+	default:
+		return fnCall.pkg == c.Pkg && fnCall.receiver == c.Receiver && fnCall.funcName == c.Name &&
+			c.matchesRecvKind(fnCall.recvKind)
+	}
+}
+
+// matchesRecvKind returns true if the method of c is called through a receiver
+// of recvKind according to the method set rules: the method set of a type only
+// has the methods declared with a value receiver while the one of a pointer to
+// it has all of them. Hence the methods declared with a value receiver match
+// recvPointer when they are called through a pointer, and the ones declared
+// with a pointer receiver never match recvValue, even when they are called
+// through an addressable value, whose address is implicitly taken.
+func (c callee) matchesRecvKind(recvKind string) bool {
+	switch recvKind {
+	case recvValue:
+		return !c.PointerRecv
+	case recvPointer:
+		return c.PointerRecv || c.Deref
+	default:
+		return true
+	}
+}
+
+// matchesPromoted returns true if c is a call to a method promoted through an
+// embedded field of the type of fnCall, e.g. "T.Reset" when T embeds
+// bytes.Buffer.
+func (c callee) matchesPromoted(fnCall funcCall) bool {
+	return c.EmbeddingReceiver != "" && fnCall.pkg == c.EmbeddingPkg &&
+		fnCall.receiver == c.EmbeddingReceiver && fnCall.funcName == c.Name && c.matchesRecvKind(fnCall.recvKind)
+}
+
+// indexOptions are the options which change how the packages are indexed.
+type indexOptions struct {
+	// backend resolves the calls, backendAST or backendSSA. Empty means
+	// backendAST.
+	backend string
+	// indirect resolves the functions which the calls through function values
+	// may call, which requires the SSA form of all the packages.
+	indirect bool
+}
+
+// indexPackages indexes pkgs according to opts concurrently with workers
+// goroutines. Zero or a negative value of workers means
+// runtime.GOMAXPROCS(0).
+//
+// The indexes are returned in the same order than pkgs and, when several
+// packages fail, the error of the first one is returned.
+func indexPackages(pkgs []*packages.Package, opts indexOptions, workers int) ([]*pkgIndex, error) {
+	var (
+		ic indirectCalls
+		sc *ssaCalls
+	)
+	// the SSA form is only built when it's used because it's much more
+	// expensive than the syntax tree
+	if opts.backend == backendSSA || opts.indirect {
+		sf := newSSAFuncs(pkgs)
+		if opts.indirect {
+			// the function values flow between the functions of all the
+			// packages
+			ic = newIndirectCalls(sf)
+		}
+
+		if opts.backend == backendSSA {
+			sc = newSSACalls(sf)
+		}
+	}
+
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(pkgs) {
+		workers = len(pkgs)
+	}
+
+	var (
+		idxs = make([]*pkgIndex, len(pkgs))
+		errs = make([]error, len(pkgs))
+		next = make(chan int)
+		wg   sync.WaitGroup
+	)
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				idxs[i], errs[i] = indexPackage(pkgs[i], ic, sc)
+			}
+		}()
+	}
+
+	for i := range pkgs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return idxs, nil
+}
+
+// indexPackage builds the callee index of pkg. ic are the indirect calls of
+// pkg, nil when they aren't resolved, and sc the calls resolved by the SSA
+// backend, nil when the AST backend is used.
+//
+// It returns an error if pkg doesn't contain the same number of compiled Go
+// files than the files found in Syntax.
+func indexPackage(pkg *packages.Package, ic indirectCalls, sc *ssaCalls) (*pkgIndex, error) {
+	if len(pkg.Syntax) != len(pkg.CompiledGoFiles) {
+		return nil, fmt.Errorf(
+			"Package with compiled Go files is reqired. Syntax files (%d) != Go files (%d)",
+			len(pkg.Syntax), len(pkg.CompiledGoFiles),
+		)
+	}
+
+	idx := &pkgIndex{PkgPath: pkg.PkgPath}
+	if pkg.Module != nil {
+		idx.Module = pkg.Module.Path
+	}
+
+	for i, f := range pkg.Syntax {
+		sf := newSourceFile(pkg, f, pkg.CompiledGoFiles[i])
+		fi := fileIndex{
+			sourceFile: sf,
+			Generated:  isGeneratedFile(sf, f),
+		}
+
+		for _, imp := range f.Imports {
+			path := strings.Trim(imp.Path.Value, `"`)
+			fi.Imports = append(fi.Imports, path)
+		}
+
+		for _, cg := range f.Comments {
+			for _, c := range cg.List {
+				if strings.HasPrefix(c.Text, suppressionDirective) {
+					fi.Directives = append(fi.Directives, directive{
+						Text: c.Text,
+						Pos:  pkg.Fset.Position(c.Pos()),
+					})
+				}
+			}
+		}
+
+		for _, d := range f.Decls {
+			fdecl, ok := d.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+
+			fn := funcIndex{
+				ID:    functionIdentifier(fdecl),
+				Pos:   sf.funcPos(pkg.Fset, fdecl),
+				Start: pkg.Fset.Position(fdecl.Pos()),
+				End:   pkg.Fset.Position(fdecl.End()),
+			}
+			if fdecl.Doc != nil {
+				fn.DocLine = pkg.Fset.Position(fdecl.Doc.Pos()).Line
+			}
+			fn.FromLine, fn.ToLine = sf.funcLines(pkg.Fset, fdecl)
+			if fdecl.Body != nil {
+				callees, ok := sc.callees(fdecl.Name, fdecl.Body, pkg.Types, pkg.TypesInfo, pkg.Fset)
+				if !ok {
+					callees = calleesInBody(fdecl.Body, pkg.Types, pkg.TypesInfo, pkg.Fset)
+				}
+
+				fn.Callees = callees
+				fn.Callees = append(fn.Callees, ic.callees(fdecl.Body, pkg.TypesInfo, pkg.Fset)...)
+				fn.Refs = refsInBody(fdecl.Body, pkg.Types, pkg.TypesInfo, pkg.Fset)
+			}
+
+			fi.Funcs = append(fi.Funcs, fn)
+		}
+
+		idx.Files = append(idx.Files, fi)
+	}
+
+	return idx, nil
+}
+
+// calleesInBody returns the calls found in the function body. typesPkg is the
+// package where the function is defined and typesInfo holds its type
+// information, which resolves the package names, so the calls through import
+// aliases and dot imports are attributed to the imported package.
+//
+// The calls whose called function cannot be identified aren't returned.
+func calleesInBody(
+	body *ast.BlockStmt, typesPkg *types.Package, typesInfo *types.Info, fset *token.FileSet,
+) []callee {
+	var callees []callee
+	ast.Inspect(body, func(n ast.Node) bool {
+		if callExpr, ok := n.(*ast.CallExpr); ok {
+			if c, ok := astCallee(callExpr, typesPkg, typesInfo); ok {
+				c.Pos = fset.Position(callExpr.Pos())
+				callees = append(callees, c)
+			}
+		}
+
+		// the arguments may have calls too
+		return true
+	})
+
+	return callees
+}
+
+// astCallee returns the callee, without position, of callExpr according to the
+// syntax tree of a function of typesPkg and typesInfo. It returns false if the
+// called function cannot be identified.
+func astCallee(callExpr *ast.CallExpr, typesPkg *types.Package, typesInfo *types.Info) (callee, bool) {
+	fun := ast.Unparen(callExpr.Fun)
+	switch f := fun.(type) {
+	// it's an instantiation of a generic function
+	case *ast.IndexExpr:
+		fun = f.X
+	case *ast.IndexListExpr:
+		fun = f.X
+	}
+
+	if ident, ok := fun.(*ast.Ident); ok {
+		switch obj := typesInfo.Uses[ident].(type) {
+		case *types.Func:
+			// it's a function of a dot import
+			if obj.Pkg() != nil && obj.Pkg() != typesPkg {
+				return callee{Kind: calleeImport, Pkg: obj.Pkg().Path(), Name: ident.Name}, true
+			}
+		case *types.Var:
+			// it's a call through a function value of a local variable,
+			// which are resolved by indirectCalls
+			if obj.Pkg() == nil || obj.Parent() != obj.Pkg().Scope() {
+				return callee{}, false
+			}
+		}
+
+		// it's a function defined in the same package
+		return callee{Kind: calleeLocal, Name: ident.Name}, true
+	}
+
+	sel, ok := fun.(*ast.SelectorExpr)
+	if !ok {
+		// it's a call to a function literal or to a function value returned
+		// by an expression, e.g. another call
+		return callee{}, false
+	}
+
+	if s, ok := typesInfo.Selections[sel]; ok {
+		// a call through a function value of a struct field is resolved by
+		// indirectCalls
+		if s.Kind() == types.FieldVal {
+			return callee{}, false
+		}
+
+		// it's a method, or a method expression, attributed to the type which
+		// declares it because it may be promoted through embedded fields
+		c, ok := methodCallee(s)
+		c.Name = sel.Sel.Name
+		return c, ok
+	}
+
+	// it's a qualified identifier whose operand is the name, or the alias,
+	// of an imported package
+	if ident, ok := sel.X.(*ast.Ident); ok {
+		if pkgName, ok := typesInfo.Uses[ident].(*types.PkgName); ok {
+			return callee{Kind: calleeImport, Pkg: pkgName.Imported().Path(), Name: sel.Sel.Name}, true
+		}
+	}
+
+	return callee{}, false
+}
+
+// refsInBody returns the references to functions found in the function body
+// which aren't calls, i.e. method values, e.g. "buf.Reset", method expressions,
+// e.g. "(*bytes.Buffer).Reset", and function values, e.g. "strings.Compare" in
+// "sort.Slice(x, strings.Compare)". typesPkg is the package where the function
+// is defined and typesInfo holds its type information.
+//
+// The references have the same kinds than the callees returned by
+// calleesInBody and their positions are the ones of the references.
+func refsInBody(
+	body *ast.BlockStmt, typesPkg *types.Package, typesInfo *types.Info, fset *token.FileSet,
+) []callee {
+	var (
+		refs   []callee
+		called = map[ast.Expr]bool{}
+	)
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			fun := ast.Unparen(n.Fun)
+			switch f := fun.(type) {
+			case *ast.IndexExpr:
+				fun = f.X
+			case *ast.IndexListExpr:
+				fun = f.X
+			}
+
+			called[fun] = true
+		case *ast.SelectorExpr:
+			if s, ok := typesInfo.Selections[n]; ok {
+				if s.Kind() == types.FieldVal || called[n] {
+					return true
+				}
+
+				if c, ok := methodCallee(s); ok {
+					c.Name = n.Sel.Name
+					c.Pos = fset.Position(n.Pos())
+					refs = append(refs, c)
+				}
+
+				return true
+			}
+
+			// it's a qualified identifier, whose operand is a package name
+			if fn, ok := typesInfo.Uses[n.Sel].(*types.Func); ok && !called[n] {
+				refs = append(refs, callee{
+					Kind: calleeImport,
+					Pkg:  fn.Pkg().Path(),
+					Name: n.Sel.Name,
+					Pos:  fset.Position(n.Pos()),
+				})
+			}
+
+			return false
+		case *ast.Ident:
+			fn, ok := typesInfo.Uses[n].(*types.Func)
+			// the methods are only referenced through selectors
+			if !ok || called[n] || fn.Pkg() == nil || fn.Type().(*types.Signature).Recv() != nil {
+				return true
+			}
+
+			c := callee{Kind: calleeLocal, Name: n.Name, Pos: fset.Position(n.Pos())}
+			if fn.Pkg() != typesPkg {
+				// it's a function of a dot import
+				c.Kind, c.Pkg = calleeImport, fn.Pkg().Path()
+			}
+
+			refs = append(refs, c)
+		}
+
+		return true
+	})
+
+	return refs
+}
+
+// methodCallee returns the calleeMethod callee, without name and position, of
+// the method selected by s, whose package and receiver are the ones of the type
+// which declares the method. When the method is promoted from an embedded
+// field, the embedding fields are set to the type of the operand of s.
+//
+// It returns false if the method isn't declared by a named type.
+func methodCallee(s *types.Selection) (callee, bool) {
+	recv := s.Obj().(*types.Func).Type().(*types.Signature).Recv()
+	pkg, typ, ok := namedType(recv.Type())
+	if !ok {
+		return callee{}, false
+	}
+
+	c := callee{Kind: calleeMethod, Pkg: pkg, Receiver: typ, PointerRecv: isPointer(recv.Type())}
+	// the receiver is a pointer, or a value with a pointer indirection in the
+	// path to the embedded field which declares the method
+	c.Deref = !c.PointerRecv && s.Indirect()
+	if pkg, typ, ok := namedType(s.Recv()); ok && (pkg != c.Pkg || typ != c.Receiver) {
+		c.EmbeddingPkg, c.EmbeddingReceiver = pkg, typ
+	}
+
+	return c, true
+}
+
+// isPointer returns true if typ is a pointer type.
+func isPointer(typ types.Type) bool {
+	_, ok := types.Unalias(typ).(*types.Pointer)
+	return ok
+}
+
+// namedType returns the package path and the name of typ, or of the type which
+// typ points to. It returns false if the type isn't a named type declared in a
+// package.
+func namedType(typ types.Type) (pkgPath string, name string, _ bool) {
+	typ = types.Unalias(typ)
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = types.Unalias(ptr.Elem())
+	}
+
+	named, ok := typ.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return "", "", false
+	}
+
+	return named.Obj().Pkg().Path(), named.Obj().Name(), true
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalleeMatches(t *testing.T) {
+	tcases := []struct {
+		name     string
+		callee   callee
+		fnCall   funcCall
+		expected bool
+	}{
+		{
+			name:     "local",
+			callee:   callee{Kind: calleeLocal, Name: "helper"},
+			fnCall:   funcCall{pkg: "example.com/a", funcName: "helper"},
+			expected: true,
+		},
+		{
+			name:     "local of other package",
+			callee:   callee{Kind: calleeLocal, Name: "helper"},
+			fnCall:   funcCall{pkg: "strings", funcName: "helper"},
+			expected: false,
+		},
+		{
+			name:     "import",
+			callee:   callee{Kind: calleeImport, Pkg: "strings", Name: "Compare"},
+			fnCall:   funcCall{pkg: "strings", funcName: "Compare"},
+			expected: true,
+		},
+		{
+			name:     "import of other package",
+			callee:   callee{Kind: calleeImport, Pkg: "strings", Name: "Compare"},
+			fnCall:   funcCall{pkg: "bytes", funcName: "Compare"},
+			expected: false,
+		},
+		{
+			name:     "method",
+			callee:   callee{Kind: calleeMethod, Pkg: "net/http/cookiejar", Receiver: "Jar", Name: "Cookies"},
+			fnCall:   funcCall{pkg: "net/http/cookiejar", receiver: "Jar", funcName: "Cookies"},
+			expected: true,
+		},
+		{
+			name:     "method of the same package",
+			callee:   callee{Kind: calleeMethod, Pkg: "example.com/a", Receiver: "T", Name: "M"},
+			fnCall:   funcCall{pkg: "example.com/a", receiver: "T", funcName: "M"},
+			expected: true,
+		},
+		{
+			name: "promoted method",
+			callee: callee{
+				Kind: calleeMethod, Pkg: "bytes", Receiver: "Buffer", Name: "Reset",
+				EmbeddingPkg: "example.com/a", EmbeddingReceiver: "T",
+			},
+			fnCall:   funcCall{pkg: "example.com/a", receiver: "T", funcName: "Reset"},
+			expected: false,
+		},
+		{
+			name:     "method of other type",
+			callee:   callee{Kind: calleeMethod, Pkg: "net/http/cookiejar", Receiver: "Jar", Name: "Cookies"},
+			fnCall:   funcCall{pkg: "net/http", receiver: "Client", funcName: "Cookies"},
+			expected: false,
+		},
+		{
+			name:     "value receiver method through a value",
+			callee:   callee{Kind: calleeMethod, Pkg: "example.com/a", Receiver: "T", Name: "M"},
+			fnCall:   funcCall{pkg: "example.com/a", receiver: "T", funcName: "M", recvKind: recvValue},
+			expected: true,
+		},
+		{
+			name:     "value receiver method through a value as pointer",
+			callee:   callee{Kind: calleeMethod, Pkg: "example.com/a", Receiver: "T", Name: "M"},
+			fnCall:   funcCall{pkg: "example.com/a", receiver: "T", funcName: "M", recvKind: recvPointer},
+			expected: false,
+		},
+		{
+			name:     "value receiver method through a pointer as value",
+			callee:   callee{Kind: calleeMethod, Pkg: "example.com/a", Receiver: "T", Name: "M", Deref: true},
+			fnCall:   funcCall{pkg: "example.com/a", receiver: "T", funcName: "M", recvKind: recvValue},
+			expected: true,
+		},
+		{
+			name:     "value receiver method through a pointer as pointer",
+			callee:   callee{Kind: calleeMethod, Pkg: "example.com/a", Receiver: "T", Name: "M", Deref: true},
+			fnCall:   funcCall{pkg: "example.com/a", receiver: "T", funcName: "M", recvKind: recvPointer},
+			expected: true,
+		},
+		{
+			name:     "pointer receiver method as value",
+			callee:   callee{Kind: calleeMethod, Pkg: "bytes", Receiver: "Buffer", Name: "Reset", PointerRecv: true},
+			fnCall:   funcCall{pkg: "bytes", receiver: "Buffer", funcName: "Reset", recvKind: recvValue},
+			expected: false,
+		},
+		{
+			name:     "pointer receiver method as pointer",
+			callee:   callee{Kind: calleeMethod, Pkg: "bytes", Receiver: "Buffer", Name: "Reset", PointerRecv: true},
+			fnCall:   funcCall{pkg: "bytes", receiver: "Buffer", funcName: "Reset", recvKind: recvPointer},
+			expected: true,
+		},
+		{
+			name:     "pointer receiver method as either",
+			callee:   callee{Kind: calleeMethod, Pkg: "bytes", Receiver: "Buffer", Name: "Reset", PointerRecv: true},
+			fnCall:   funcCall{pkg: "bytes", receiver: "Buffer", funcName: "Reset"},
+			expected: true,
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.callee.matches(tc.fnCall, "example.com/a"))
+		})
+	}
+}
+
+func TestIndexPackagesJSON(t *testing.T) {
+	pkgs, err := loadPackages("", []string{
+		"./testdata/testpkg", "./testdata/suppressed", "./testdata/linedir",
+	})
+	require.NoError(t, err)
+
+	idxs, err := indexPackages(pkgs, indexOptions{}, 0)
+	require.NoError(t, err)
+	require.Len(t, idxs, len(pkgs))
+
+	// The indexes are cached in JSON, so they must not lose any information.
+	for _, idx := range idxs {
+		data, err := json.Marshal(idx)
+		require.NoError(t, err)
+
+		var decoded pkgIndex
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, *idx, decoded)
+	}
+}
+
+func TestRunImports(t *testing.T) {
+	const pkg = "github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/imports"
+
+	tcases := []struct {
+		name     string
+		funcs    string
+		expected string
+	}{
+		{
+			name:     "alias",
+			funcs:    "path/filepath.Join",
+			expected: "testdata/imports/alias.go:8:1: aliasJoin: default[warning]\n",
+		},
+		{
+			name:     "package with the same func name than an alias",
+			funcs:    "path.Join",
+			expected: "testdata/imports/alias.go:12:1: pathJoin: default[warning]\n",
+		},
+		{
+			// blankCompare calls a method of a variable named as the package
+			// imported with the blank identifier
+			name:     "dot and blank imports",
+			funcs:    "strings.Compare",
+			expected: "testdata/imports/dot.go:5:1: dotCompare: default[warning]\n",
+		},
+	}
+
+	for _, backend := range []string{backendAST, backendSSA} {
+		for _, tc := range tcases {
+			tc := tc
+			t.Run(backend+"/"+tc.name, func(t *testing.T) {
+				var stdout, stderr bytes.Buffer
+				code := run([]string{"-backend", backend, "-funcs", tc.funcs, pkg}, &stdout, &stderr)
+				require.Equal(t, exitCodeOK, code, "stderr: %s", stderr.String())
+				assert.Equal(t, tc.expected, stdout.String())
+			})
+		}
+	}
+}
+
+func TestCalleeMatchesPromoted(t *testing.T) {
+	c := callee{
+		Kind: calleeMethod, Pkg: "bytes", Receiver: "Buffer", Name: "Reset",
+		EmbeddingPkg: "example.com/a", EmbeddingReceiver: "T",
+	}
+	assert.True(t, c.matchesPromoted(funcCall{pkg: "example.com/a", receiver: "T", funcName: "Reset"}))
+	assert.False(t, c.matchesPromoted(funcCall{pkg: "bytes", receiver: "Buffer", funcName: "Reset"}))
+	assert.False(t, c.matchesPromoted(funcCall{pkg: "example.com/a", receiver: "T", funcName: "Len"}))
+
+	c.EmbeddingPkg, c.EmbeddingReceiver = "", ""
+	assert.False(t, c.matchesPromoted(funcCall{funcName: "Reset"}))
+}
+
+func TestRunPromoted(t *testing.T) {
+	const pkg = "github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/embedded"
+
+	tcases := []struct {
+		name     string
+		funcs    string
+		promoted bool
+		expected string
+	}{
+		{
+			name:  "declaring type",
+			funcs: "bytes.Buffer.Reset",
+			expected: "testdata/embedded/embedded.go:12:1: *buffer.reset: default[warning]\n" +
+				"testdata/embedded/embedded.go:21:1: resetBuffer: default[warning]\n" +
+				"testdata/embedded/embedded.go:25:1: resetWrapper: default[warning]\n" +
+				"testdata/embedded/embedded.go:29:1: resetWrapperBuffer: default[warning]\n" +
+				"testdata/embedded/embedded.go:33:1: resetPromotedField: default[warning]\n",
+		},
+		{
+			name:     "embedding type",
+			funcs:    ".buffer.Reset",
+			expected: "",
+		},
+		{
+			name:     "embedding type with promoted",
+			funcs:    ".buffer.Reset",
+			promoted: true,
+			expected: "testdata/embedded/embedded.go:21:1: resetBuffer: default[warning]\n" +
+				"testdata/embedded/embedded.go:29:1: resetWrapperBuffer: default[warning]\n",
+		},
+		{
+			name:     "outer embedding type with promoted",
+			funcs:    ".wrapper.Reset",
+			promoted: true,
+			expected: "testdata/embedded/embedded.go:25:1: resetWrapper: default[warning]\n",
+		},
+		{
+			name:     "method of the same package",
+			funcs:    ".buffer.reset",
+			expected: "testdata/embedded/embedded.go:37:1: resetUnexported: default[warning]\n",
+		},
+		{
+			name:     "interface method of an embedded interface",
+			funcs:    "io.Reader.Read",
+			expected: "testdata/embedded/embedded.go:41:1: read: default[warning]\n",
+		},
+		{
+			name:     "interface method of the embedding interface",
+			funcs:    "io.ReadCloser.Read",
+			expected: "",
+		},
+		{
+			name:     "interface method of the embedding interface with promoted",
+			funcs:    "io.ReadCloser.Read",
+			promoted: true,
+			expected: "testdata/embedded/embedded.go:41:1: read: default[warning]\n",
+		},
+	}
+
+	for _, backend := range []string{backendAST, backendSSA} {
+		for _, tc := range tcases {
+			tc := tc
+			t.Run(backend+"/"+tc.name, func(t *testing.T) {
+				args := []string{"-backend", backend, "-funcs", tc.funcs, pkg}
+				if tc.promoted {
+					args = append([]string{"-promoted"}, args...)
+				}
+
+				var stdout, stderr bytes.Buffer
+				code := run(args, &stdout, &stderr)
+				require.Equal(t, exitCodeOK, code, "stderr: %s", stderr.String())
+				assert.Equal(t, tc.expected, stdout.String())
+			})
+		}
+	}
+}
+
+func TestRunRefs(t *testing.T) {
+	const pkg = "github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/refs"
+
+	tcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name: "calls",
+			args: []string{"-funcs", "bytes.Buffer.Reset"},
+			expected: "testdata/refs/refs.go:19:1: callMethodExpression: default[warning]\n" +
+				"testdata/refs/refs.go:23:1: callAndValue: default[warning]\n" +
+				"testdata/refs/refs.go:54:1: callAndArgument: default[warning]\n",
+		},
+		{
+			name: "method values and expressions",
+			args: []string{"-refs", "-funcs", "bytes.Buffer.Reset"},
+			expected: "testdata/refs/refs.go:9:1: methodValue: default[warning] (ref)\n" +
+				"testdata/refs/refs.go:14:1: methodExpression: default[warning] (ref)\n" +
+				"testdata/refs/refs.go:19:1: callMethodExpression: default[warning]\n" +
+				"testdata/refs/refs.go:23:1: callAndValue: default[warning]\n" +
+				"testdata/refs/refs.go:54:1: callAndArgument: default[warning]\n",
+		},
+		{
+			name: "method values and expressions called indirectly",
+			args: []string{"-refs", "-indirect", "-funcs", "bytes.Buffer.Reset"},
+			expected: "testdata/refs/refs.go:9:1: methodValue: default[warning] (indirect)\n" +
+				"testdata/refs/refs.go:14:1: methodExpression: default[warning] (indirect)\n" +
+				"testdata/refs/refs.go:19:1: callMethodExpression: default[warning]\n" +
+				"testdata/refs/refs.go:23:1: callAndValue: default[warning]\n" +
+				"testdata/refs/refs.go:54:1: callAndArgument: default[warning]\n",
+		},
+		{
+			name: "function of the same package as argument",
+			args: []string{"-refs", "-funcs", ".less"},
+			expected: "testdata/refs/refs.go:32:1: callInFuncLit: default[warning]\n" +
+				"testdata/refs/refs.go:36:1: argument: default[warning] (ref)\n",
+		},
+		{
+			name: "function of the same package as argument called indirectly",
+			args: []string{"-refs", "-indirect", "-funcs", ".less"},
+			expected: "testdata/refs/refs.go:32:1: callInFuncLit: default[warning]\n" +
+				"testdata/refs/refs.go:36:1: argument: default[warning] (ref)\n" +
+				"testdata/refs/refs.go:40:1: sortStrings: default[warning] (indirect)\n",
+		},
+		{
+			name: "imported function as argument",
+			args: []string{"-refs", "-funcs", "strings.ToUpper"},
+			expected: "testdata/refs/refs.go:44:1: upper: default[warning] (ref)\n" +
+				"testdata/refs/refs.go:54:1: callAndArgument: default[warning] (ref)\n",
+		},
+		{
+			name:     "call and reference",
+			args:     []string{"-refs", "-funcs", "bytes.Buffer.Reset,strings.ToUpper"},
+			expected: "testdata/refs/refs.go:54:1: callAndArgument: default[warning] (ref)\n",
+		},
+		{
+			name: "subsets",
+			args: []string{"-refs", "-sub", "1", "-funcs", "bytes.Buffer.Reset,strings.ToUpper"},
+			expected: "testdata/refs/refs.go:9:1: methodValue: default[warning] (ref)\n" +
+				"testdata/refs/refs.go:14:1: methodExpression: default[warning] (ref)\n" +
+				"testdata/refs/refs.go:19:1: callMethodExpression: default[warning]\n" +
+				"testdata/refs/refs.go:23:1: callAndValue: default[warning]\n" +
+				"testdata/refs/refs.go:44:1: upper: default[warning] (ref)\n" +
+				"testdata/refs/refs.go:54:1: callAndArgument: default[warning]\n",
+		},
+	}
+
+	for _, backend := range []string{backendAST, backendSSA} {
+		for _, tc := range tcases {
+			tc := tc
+			t.Run(backend+"/"+tc.name, func(t *testing.T) {
+				args := append([]string{"-backend", backend}, tc.args...)
+
+				var stdout, stderr bytes.Buffer
+				code := run(append(args, pkg), &stdout, &stderr)
+				require.Equal(t, exitCodeOK, code, "stderr: %s", stderr.String())
+				assert.Equal(t, tc.expected, stdout.String())
+			})
+		}
+	}
+}
+
+func TestRunIndirect(t *testing.T) {
+	const pkg = "github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/indirect"
+
+	tcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "without indirect calls",
+			args:     []string{"-sub", "1", "-funcs", "log.Printf,strings.ToUpper"},
+			expected: "testdata/indirect/indirect.go:36:1: callAndLocalVar: default[warning]\n",
+		},
+		{
+			name: "struct field and call result",
+			args: []string{"-indirect", "-funcs", "log.Printf"},
+			expected: "testdata/indirect/indirect.go:17:1: logStart: default[warning] (indirect)\n" +
+				"testdata/indirect/indirect.go:41:1: callResult: default[warning] (indirect)\n",
+		},
+		{
+			name: "local variable",
+			args: []string{"-indirect", "-funcs", "strings.ToUpper"},
+			expected: "testdata/indirect/indirect.go:31:1: localVar: default[warning] (indirect)\n" +
+				"testdata/indirect/indirect.go:36:1: callAndLocalVar: default[warning]\n",
+		},
+		{
+			name:     "package variable",
+			args:     []string{"-indirect", "-funcs", ".hook"},
+			expected: "testdata/indirect/indirect.go:27:1: runHook: default[warning]\n",
+		},
+		{
+			name: "subsets",
+			args: []string{"-indirect", "-sub", "1", "-funcs", "log.Printf,strings.ToUpper"},
+			expected: "testdata/indirect/indirect.go:17:1: logStart: default[warning] (indirect)\n" +
+				"testdata/indirect/indirect.go:31:1: localVar: default[warning] (indirect)\n" +
+				"testdata/indirect/indirect.go:36:1: callAndLocalVar: default[warning]\n" +
+				"testdata/indirect/indirect.go:41:1: callResult: default[warning] (indirect)\n",
+		},
+	}
+
+	for _, backend := range []string{backendAST, backendSSA} {
+		for _, tc := range tcases {
+			tc := tc
+			t.Run(backend+"/"+tc.name, func(t *testing.T) {
+				args := append([]string{"-backend", backend}, tc.args...)
+
+				var stdout, stderr bytes.Buffer
+				code := run(append(args, pkg), &stdout, &stderr)
+				require.Equal(t, exitCodeOK, code, "stderr: %s", stderr.String())
+				assert.Equal(t, tc.expected, stdout.String())
+			})
+		}
+	}
+}
+
+func TestRunRecvKind(t *testing.T) {
+	const pkg = "github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/recvkind"
+
+	tcases := []struct {
+		name     string
+		funcs    string
+		expected string
+		stderr   string
+	}{
+		{
+			name:  "value receiver method through either",
+			funcs: ".T.Value",
+			expected: "testdata/recvkind/recvkind.go:11:1: valueOnValue: default[warning]\n" +
+				"testdata/recvkind/recvkind.go:15:1: valueOnPointer: default[warning]\n" +
+				"testdata/recvkind/recvkind.go:19:1: valueOnEmbeddedPointer: default[warning]\n" +
+				"testdata/recvkind/recvkind.go:23:1: valueMethodExpression: default[warning]\n",
+		},
+		{
+			name:  "value receiver method through a value",
+			funcs: "(.T).Value",
+			expected: "testdata/recvkind/recvkind.go:11:1: valueOnValue: default[warning]\n" +
+				"testdata/recvkind/recvkind.go:15:1: valueOnPointer: default[warning]\n" +
+				"testdata/recvkind/recvkind.go:19:1: valueOnEmbeddedPointer: default[warning]\n" +
+				"testdata/recvkind/recvkind.go:23:1: valueMethodExpression: default[warning]\n",
+		},
+		{
+			name:  "value receiver method through a pointer",
+			funcs: "(*.T).Value",
+			expected: "testdata/recvkind/recvkind.go:15:1: valueOnPointer: default[warning]\n" +
+				"testdata/recvkind/recvkind.go:19:1: valueOnEmbeddedPointer: default[warning]\n" +
+				"testdata/recvkind/recvkind.go:23:1: valueMethodExpression: default[warning]\n",
+		},
+		{
+			name:  "pointer receiver method through a pointer",
+			funcs: "(*.T).Pointer",
+			expected: "testdata/recvkind/recvkind.go:27:1: pointerOnAddressable: default[warning]\n" +
+				"testdata/recvkind/recvkind.go:31:1: pointerOnPointer: default[warning]\n",
+		},
+		{
+			name:  "pointer receiver method through a value",
+			funcs: "(" + pkg + ".T).Pointer",
+			stderr: `warning: rule "default": method "Pointer" of type "` + pkg + `.T" has a pointer receiver, ` +
+				`did you mean "(*` + pkg + `.T).Pointer"?` + "\n",
+		},
+	}
+
+	for _, backend := range []string{backendAST, backendSSA} {
+		for _, tc := range tcases {
+			tc := tc
+			t.Run(backend+"/"+tc.name, func(t *testing.T) {
+				var stdout, stderr bytes.Buffer
+				code := run([]string{"-backend", backend, "-funcs", tc.funcs, pkg}, &stdout, &stderr)
+				require.Equal(t, exitCodeOK, code, "stderr: %s", stderr.String())
+				assert.Equal(t, tc.expected, stdout.String())
+				assert.Equal(t, tc.stderr, stderr.String())
+			})
+		}
+	}
+}
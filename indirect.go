@@ -0,0 +1,259 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/callgraph/vta"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// indirectCalls are the functions which the calls through function values,
+// e.g. a local variable or a struct field of a function type, may call, by the
+// position of the left parenthesis of the call.
+type indirectCalls map[token.Pos][]callee
+
+// ssaFuncs are the functions declared in the analyzed packages in SSA form.
+type ssaFuncs struct {
+	// decls are the declared functions and methods by their object.
+	decls map[*types.Func]*ssa.Function
+	// funcs are the declared functions and methods and all the function
+	// literals which they contain.
+	funcs map[*ssa.Function]bool
+}
+
+// newSSAFuncs builds the SSA form of pkgs and returns their declared functions.
+// The packages with type errors don't have SSA form, so their functions aren't
+// returned.
+func newSSAFuncs(pkgs []*packages.Package) ssaFuncs {
+	prog, ssaPkgs := ssautil.Packages(pkgs, 0)
+
+	sf := ssaFuncs{decls: map[*types.Func]*ssa.Function{}, funcs: map[*ssa.Function]bool{}}
+	var addFunc func(fn *ssa.Function)
+	addFunc = func(fn *ssa.Function) {
+		if fn == nil || sf.funcs[fn] {
+			return
+		}
+
+		sf.funcs[fn] = true
+		for _, anon := range fn.AnonFuncs {
+			addFunc(anon)
+		}
+	}
+
+	for i, sp := range ssaPkgs {
+		if sp == nil {
+			continue
+		}
+
+		sp.Build()
+		for _, f := range pkgs[i].Syntax {
+			for _, d := range f.Decls {
+				fdecl, ok := d.(*ast.FuncDecl)
+				if !ok {
+					continue
+				}
+
+				if obj, ok := pkgs[i].TypesInfo.Defs[fdecl.Name].(*types.Func); ok {
+					if fn := prog.FuncValue(obj); fn != nil {
+						sf.decls[obj] = fn
+						addFunc(fn)
+					}
+				}
+			}
+		}
+	}
+
+	return sf
+}
+
+// newIndirectCalls resolves the functions which the calls through function
+// values of the functions of sf may call, with the variable type analysis
+// (VTA). Only the declared functions and methods are kept because the calls of
+// the function literals are attributed to the functions which contain them.
+//
+// The function values are only followed through the functions of sf, so the
+// calls through the values which come from other packages aren't resolved.
+func newIndirectCalls(sf ssaFuncs) indirectCalls {
+	funcs := sf.funcs
+	ic := indirectCalls{}
+	if len(funcs) == 0 {
+		return ic
+	}
+
+	// the functions used as values, e.g. the ones of other packages or the
+	// wrappers of the method values, are only resolved as targets when they
+	// are analyzed too
+	analyzed := make(map[*ssa.Function]bool, len(funcs))
+	for fn := range funcs {
+		analyzed[fn] = true
+		for _, b := range fn.Blocks {
+			for _, instr := range b.Instrs {
+				for _, op := range instr.Operands(nil) {
+					if f, ok := (*op).(*ssa.Function); ok {
+						analyzed[f] = true
+					}
+				}
+			}
+		}
+	}
+
+	cg := vta.CallGraph(analyzed, nil)
+	for fn := range funcs {
+		node := cg.Nodes[fn]
+		if node == nil {
+			continue
+		}
+
+		for _, e := range node.Out {
+			// the interface method calls are indexed by the name of the method
+			common := e.Site.Common()
+			if common.IsInvoke() {
+				continue
+			}
+
+			c, ok := funcCallee(e.Callee.Func, fn.Pkg.Pkg)
+			if !ok {
+				continue
+			}
+
+			c.Indirect = true
+
+			pos := common.Pos()
+			if !containsCallee(ic[pos], c) {
+				ic[pos] = append(ic[pos], c)
+			}
+		}
+	}
+
+	for _, callees := range ic {
+		sortCallees(callees)
+	}
+
+	return ic
+}
+
+// sortCallees sorts the callees of the same call by package, receiver and
+// name.
+func sortCallees(callees []callee) {
+	sort.Slice(callees, func(i, j int) bool {
+		a, b := callees[i], callees[j]
+		if a.Pkg != b.Pkg {
+			return a.Pkg < b.Pkg
+		}
+
+		if a.Receiver != b.Receiver {
+			return a.Receiver < b.Receiver
+		}
+
+		return a.Name < b.Name
+	})
+}
+
+// callees returns the indirect callees of the calls of body which aren't
+// direct calls to a function or method, with their positions adjusted by the
+// //line directives of fset. typesInfo holds the type information of the
+// package where body is.
+func (ic indirectCalls) callees(body *ast.BlockStmt, typesInfo *types.Info, fset *token.FileSet) []callee {
+	var callees []callee
+	ast.Inspect(body, func(n ast.Node) bool {
+		if callExpr, ok := n.(*ast.CallExpr); ok && !isDirectCall(callExpr, typesInfo) {
+			for _, c := range ic[callExpr.Lparen] {
+				c.Pos = fset.Position(callExpr.Pos())
+				callees = append(callees, c)
+			}
+		}
+
+		return true
+	})
+
+	return callees
+}
+
+// isDirectCall returns true if callExpr calls a function, or a method, which
+// is referred by its name instead of through a function value.
+func isDirectCall(callExpr *ast.CallExpr, typesInfo *types.Info) bool {
+	fun := ast.Unparen(callExpr.Fun)
+	switch f := fun.(type) {
+	case *ast.IndexExpr:
+		fun = f.X
+	case *ast.IndexListExpr:
+		fun = f.X
+	}
+
+	switch f := fun.(type) {
+	case *ast.Ident:
+		_, ok := typesInfo.Uses[f].(*types.Func)
+		return ok
+	case *ast.SelectorExpr:
+		if s, ok := typesInfo.Selections[f]; ok {
+			return s.Kind() != types.FieldVal
+		}
+
+		_, ok := typesInfo.Uses[f.Sel].(*types.Func)
+		return ok
+	default:
+		return false
+	}
+}
+
+// funcCallee returns the callee, without position, of a call to fn from a
+// function of the package pkg. It returns false if fn isn't a declared function
+// or method, nor a wrapper of a method value or expression, which have the
+// method as object.
+func funcCallee(fn *ssa.Function, pkg *types.Package) (callee, bool) {
+	obj, ok := fn.Object().(*types.Func)
+	if !ok {
+		return callee{}, false
+	}
+
+	return objCallee(obj, pkg)
+}
+
+// objCallee returns the callee, without position, of a call to the function
+// or method obj from a function of the package pkg. It returns false if obj
+// doesn't belong to a package or its receiver isn't a named type.
+func objCallee(obj types.Object, pkg *types.Package) (callee, bool) {
+	if obj.Pkg() == nil {
+		return callee{}, false
+	}
+
+	if sig, ok := obj.Type().(*types.Signature); ok && sig.Recv() != nil {
+		pkgPath, typ, ok := namedType(sig.Recv().Type())
+		if !ok {
+			return callee{}, false
+		}
+
+		return callee{
+			Kind:        calleeMethod,
+			Pkg:         pkgPath,
+			Receiver:    typ,
+			Name:        obj.Name(),
+			PointerRecv: isPointer(sig.Recv().Type()),
+		}, true
+	}
+
+	if obj.Pkg() == pkg {
+		return callee{Kind: calleeLocal, Name: obj.Name()}, true
+	}
+
+	return callee{Kind: calleeImport, Pkg: obj.Pkg().Path(), Name: obj.Name()}, true
+}
+
+// containsCallee returns true if callees contains c.
+func containsCallee(callees []callee, c callee) bool {
+	for _, ce := range callees {
+		if ce == c {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,446 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// interactiveCmd is the name of the subcommand which offers a prompt for
+// querying the packages.
+const interactiveCmd = "interactive"
+
+// interactivePrompt is the prompt shown when the input is a terminal.
+const interactivePrompt = "> "
+
+// interactiveHelp is the help of the commands of the interactive prompt.
+const interactiveHelp = `commands:
+  <funcs>             find the functions which call all the funcs, with the same format than the funcs flag
+  find <funcs>        same as above
+  sub <n>             find the functions which call any subset of n funcs, 0 means all of them
+  callees <func>      list the calls of the function with the package qualified name func
+  transitive [on|off] toggle the transitive mode, which follows the calls through the loaded functions
+  reload              load the packages again
+  help                show this help
+  exit                exit
+`
+
+// interactiveCommands are the names of the commands of the interactive prompt.
+var interactiveCommands = []string{"callees", "exit", "find", "help", "reload", "sub", "transitive"}
+
+// interactiveParams are the command line flags and arguments of the
+// interactive subcommand.
+type interactiveParams struct {
+	packagesParams
+}
+
+// parseInteractiveParams parses and maps the command line flags and arguments
+// of the interactive subcommand. inParams is the list of command line
+// arguments after the subcommand name. The packages patterns are "./..." when
+// there isn't any.
+func parseInteractiveParams(inParams []string) (interactiveParams, error) {
+	fset := flag.NewFlagSet(interactiveCmd, flag.ContinueOnError)
+	pflags := addPackagesFlags(fset)
+
+	if err := fset.Parse(inParams); err != nil {
+		return interactiveParams{}, err
+	}
+
+	pp, err := pflags.params()
+	if err != nil {
+		return interactiveParams{}, err
+	}
+
+	return interactiveParams{packagesParams: pp}, nil
+}
+
+// runInteractive executes the interactive subcommand with args, which are the
+// command line arguments after the subcommand name, reading the commands from
+// stdin until it's closed or the exit command, and returns the exit code.
+//
+// When stdin is a terminal, it's put in raw mode for editing the lines and
+// completing the package paths, the types and the functions with the tab key.
+func runInteractive(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	ip, err := parseInteractiveParams(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitCodeOK
+		}
+
+		fmt.Fprintln(stderr, err)
+		return exitCodeUsage
+	}
+
+	r, err := newREPL(".", ip)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitCodeError
+	}
+
+	fmt.Fprintf(stderr, "loaded %d packages, type help for the list of commands\n", len(r.idxs))
+
+	if f, ok := stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		state, err := term.MakeRaw(int(f.Fd()))
+		if err != nil {
+			fmt.Fprintf(stderr, "error while setting terminal raw mode: %v\n", err)
+			return exitCodeError
+		}
+		defer func() { _ = term.Restore(int(f.Fd()), state) }()
+
+		t := term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{stdin, stdout}, interactivePrompt)
+		t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+			if key != '\t' {
+				return "", 0, false
+			}
+
+			newLine, newPos, candidates := r.complete(line, pos)
+			if len(candidates) > 1 {
+				fmt.Fprintln(t, strings.Join(candidates, "  "))
+			}
+
+			return newLine, newPos, true
+		}
+
+		for {
+			line, err := t.ReadLine()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					return exitCodeOK
+				}
+
+				fmt.Fprintln(stderr, err)
+				return exitCodeError
+			}
+
+			if r.exec(line, t) {
+				return exitCodeOK
+			}
+		}
+	}
+
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		if r.exec(scanner.Text(), stdout) {
+			return exitCodeOK
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitCodeError
+	}
+
+	return exitCodeOK
+}
+
+// repl holds the packages loaded by the interactive subcommand and the state
+// of its prompt.
+type repl struct {
+	dir string
+	ip  interactiveParams
+
+	idxs []*pkgIndex
+	// typesPkgs are the type information of the loaded packages and all their
+	// dependencies by their path.
+	typesPkgs typesPackages
+	// analyzed are the paths of the packages which match the patterns.
+	analyzed map[string]bool
+
+	transitive bool
+	sub        uint
+}
+
+// newREPL returns a repl of the packages which match the patterns of ip,
+// relative to dir, after loading them.
+func newREPL(dir string, ip interactiveParams) (*repl, error) {
+	r := &repl{dir: dir, ip: ip}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// load loads and indexes the packages.
+func (r *repl) load() error {
+	pkgs, err := loadPackages(r.dir, r.ip.pkgsPatterns)
+	if err != nil {
+		return err
+	}
+
+	idxs, err := indexPackages(pkgs, indexOptions{}, r.ip.workers)
+	if err != nil {
+		return err
+	}
+
+	typesPkgs := newTypesPackages(pkgs)
+	analyzed := make(map[string]bool, len(pkgs))
+	for _, p := range pkgs {
+		analyzed[p.PkgPath] = true
+	}
+
+	r.idxs, r.typesPkgs, r.analyzed = idxs, typesPkgs, analyzed
+	return nil
+}
+
+// exec executes the command line and writes its output to w. It returns true
+// when the command is exit.
+func (r *repl) exec(line string, w io.Writer) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+
+	switch cmd, args := fields[0], fields[1:]; cmd {
+	case "exit", "quit":
+		return true
+
+	case "help":
+		fmt.Fprint(w, interactiveHelp)
+
+	case "find":
+		r.find(strings.Join(args, " "), w)
+
+	case "sub":
+		if len(args) != 1 {
+			fmt.Fprintln(w, "error: sub requires a number")
+			break
+		}
+
+		n, err := strconv.ParseUint(args[0], 10, 0)
+		if err != nil {
+			fmt.Fprintf(w, "error: invalid sub value %q\n", args[0])
+			break
+		}
+
+		r.sub = uint(n)
+		fmt.Fprintf(w, "sub: %d\n", r.sub)
+
+	case "callees":
+		if len(args) != 1 {
+			fmt.Fprintln(w, "error: callees requires a function name")
+			break
+		}
+
+		r.callees(args[0], w)
+
+	case "transitive":
+		switch {
+		case len(args) == 0:
+			r.transitive = !r.transitive
+		case len(args) == 1 && args[0] == "on":
+			r.transitive = true
+		case len(args) == 1 && args[0] == "off":
+			r.transitive = false
+		default:
+			fmt.Fprintln(w, "error: transitive accepts on or off")
+			return false
+		}
+
+		if r.transitive {
+			fmt.Fprintln(w, "transitive mode: on")
+		} else {
+			fmt.Fprintln(w, "transitive mode: off")
+		}
+
+	case "reload":
+		if err := r.load(); err != nil {
+			fmt.Fprintf(w, "error: %v\n", err)
+			break
+		}
+
+		fmt.Fprintf(w, "loaded %d packages\n", len(r.idxs))
+
+	default:
+		r.find(strings.Join(fields, " "), w)
+	}
+
+	return false
+}
+
+// find writes to w the functions which call the functions of funcs, which has
+// the format of the funcs flag.
+func (r *repl) find(funcs string, w io.Writer) {
+	fcalls, err := parseFuncCalls(funcs)
+	if err != nil {
+		fmt.Fprintf(w, "error: %v\n", err)
+		return
+	}
+
+	rl := rule{
+		name:      defaultRuleName,
+		severity:  severityWarning,
+		funcCalls: fcalls,
+		subsetsOf: r.sub,
+	}
+
+	opts := findOptions{keepFile: r.ip.keepFile}
+	if r.transitive {
+		opts.calls = newCallGraph(r.idxs)
+	}
+
+	rules, err := resolvePkgNames([]rule{rl}, r.idxs, r.typesPkgs)
+	if err != nil {
+		fmt.Fprintf(w, "error: %v\n", err)
+		return
+	}
+	rl = rules[0]
+
+	for _, msg := range r.typesPkgs.withUnimported(r.dir, []rule{rl}).checkFuncCalls(rl.funcCalls) {
+		fmt.Fprintf(w, "warning: %s\n", msg)
+	}
+
+	sups, _ := collectSuppressions(r.idxs, r.ip.keepFile)
+	results := []ruleResult{{rule: rl, funcsFiles: findRule(r.idxs, rl, sups, opts)}}
+	err = printResults(w, outputOptions{format: formatText, pathMode: pathModule, sortBy: sortFile}, results)
+	if err != nil {
+		fmt.Fprintf(w, "error: %v\n", err)
+		return
+	}
+
+	fmt.Fprintf(w, "%d matching functions\n", countMatches(results[0].funcsFiles))
+}
+
+// callees writes to w the calls of the function with the package qualified
+// name.
+func (r *repl) callees(name string, w io.Writer) {
+	callees, ok := findCallees(r.idxs, name)
+	if !ok {
+		fmt.Fprintf(w, "error: function %q not found\n", name)
+		return
+	}
+
+	for _, c := range callees {
+		pos := position{Filename: c.Filename, Line: c.Line, Column: c.Column}
+		var line string
+		switch c.Kind {
+		case calleeMethod:
+			line = fmt.Sprintf("%s: %s.%s.%s", pos, c.Pkg, c.Receiver, c.Name)
+		case calleeImport:
+			line = fmt.Sprintf("%s: %s.%s (%s)", pos, c.Pkg, c.Name, c.Kind)
+		default:
+			line = fmt.Sprintf("%s: %s (%s)", pos, c.Name, c.Kind)
+		}
+
+		if c.Indirect {
+			line += " (indirect)"
+		}
+
+		fmt.Fprintln(w, line)
+	}
+}
+
+// complete completes the word of line which ends at pos. It returns the new
+// line and position, and the candidates when there is more than one. The
+// positions are byte offsets, as x/term uses them.
+func (r *repl) complete(line string, pos int) (string, int, []string) {
+	start := strings.LastIndexAny(line[:pos], " ,") + 1
+	prefix := line[start:pos]
+
+	var candidates []string
+	if start == 0 {
+		for _, cmd := range interactiveCommands {
+			if strings.HasPrefix(cmd, prefix) {
+				candidates = append(candidates, cmd)
+			}
+		}
+	}
+
+	candidates = append(candidates, r.completions(prefix)...)
+	if len(candidates) == 0 {
+		return line, pos, nil
+	}
+
+	common := candidates[0]
+	for _, c := range candidates[1:] {
+		// trimmed by runes for never leaving a partial UTF-8 sequence
+		for !strings.HasPrefix(c, common) {
+			_, size := utf8.DecodeLastRuneInString(common)
+			common = common[:len(common)-size]
+		}
+	}
+
+	newLine := line[:start] + common + line[pos:]
+	newPos := start + len(common)
+	if len(candidates) == 1 {
+		return newLine, newPos, nil
+	}
+
+	return newLine, newPos, candidates
+}
+
+// completions returns the package paths, the package qualified functions and
+// types, and the methods of the types, which start by prefix, sorted. The
+// unexported identifiers are only returned for the analyzed packages.
+func (r *repl) completions(prefix string) []string {
+	var candidates []string
+	for path := range r.typesPkgs {
+		if strings.HasPrefix(path, prefix) {
+			candidates = append(candidates, path)
+		}
+	}
+
+	slash := strings.LastIndex(prefix, "/")
+	dot := strings.Index(prefix[slash+1:], ".")
+	if dot < 0 {
+		sort.Strings(candidates)
+		return candidates
+	}
+
+	var (
+		pkgPath = prefix[:slash+1+dot]
+		member  = prefix[slash+1+dot+1:]
+		tpkg    = r.typesPkgs[pkgPath]
+	)
+	if tpkg == nil {
+		sort.Strings(candidates)
+		return candidates
+	}
+
+	visible := func(name string) bool {
+		return r.analyzed[pkgPath] || token.IsExported(name)
+	}
+
+	if typName, method, ok := strings.Cut(member, "."); ok {
+		tn, ok := tpkg.Scope().Lookup(typName).(*types.TypeName)
+		if ok {
+			for _, sel := range methodSet(tn.Type()) {
+				name := sel.Obj().Name()
+				if strings.HasPrefix(name, method) && visible(name) {
+					candidates = append(candidates, fmt.Sprintf("%s.%s.%s", pkgPath, typName, name))
+				}
+			}
+		}
+	} else {
+		for _, name := range tpkg.Scope().Names() {
+			if !strings.HasPrefix(name, member) || !visible(name) {
+				continue
+			}
+
+			switch tpkg.Scope().Lookup(name).(type) {
+			case *types.Func, *types.TypeName:
+				candidates = append(candidates, fmt.Sprintf("%s.%s", pkgPath, name))
+			}
+		}
+	}
+
+	sort.Strings(candidates)
+	return candidates
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestREPL(t *testing.T) {
+	modDir, writeFile := newWatchModule(t)
+	writeFile("b/b.go", `package b
+
+import (
+	"bytes"
+
+	"example.com/watchtest/a"
+)
+
+type Buffer struct{ buf bytes.Buffer }
+
+func (b *Buffer) Reset() { b.buf.Reset() }
+
+func (b *Buffer) reset() {}
+
+func G() { a.F() }
+`)
+
+	ip, err := parseInteractiveParams(nil)
+	require.NoError(t, err)
+
+	r, err := newREPL(modDir, ip)
+	require.NoError(t, err)
+
+	exec := func(line string) string {
+		var out bytes.Buffer
+		assert.False(t, r.exec(line, &out))
+		return out.String()
+	}
+
+	t.Run("find", func(t *testing.T) {
+		assert.Equal(t, "a/a.go:5:1: F: default[warning]\n1 matching functions\n", exec("strings.Compare"))
+		assert.Equal(t, exec("strings.Compare"), exec("find strings.Compare"))
+		assert.Equal(t, "0 matching functions\n", exec("find strings.Compare, bytes.Buffer.Reset"))
+		assert.Contains(t, exec("find Compare"), "error: ")
+		assert.Equal(t,
+			"warning: unknown function \"Compar\" in package \"strings\", did you mean \"Compare\"?\n"+
+				"0 matching functions\n",
+			exec("strings.Compar"),
+		)
+	})
+
+	t.Run("sub", func(t *testing.T) {
+		assert.Equal(t, "sub: 1\n", exec("sub 1"))
+		assert.Contains(t, exec("find strings.Compare, bytes.Buffer.Reset"), "2 matching functions\n")
+		assert.Equal(t, "sub: 0\n", exec("sub 0"))
+		assert.Equal(t, "error: invalid sub value \"x\"\n", exec("sub x"))
+	})
+
+	t.Run("transitive", func(t *testing.T) {
+		assert.Equal(t, "transitive mode: on\n", exec("transitive"))
+		assert.Contains(t, exec("strings.Compare"), "b/b.go:15:1: G: default[warning]\n2 matching functions\n")
+		assert.Equal(t, "transitive mode: off\n", exec("transitive"))
+		assert.Equal(t, "transitive mode: on\n", exec("transitive on"))
+		assert.Equal(t, "transitive mode: off\n", exec("transitive off"))
+		assert.Contains(t, exec("strings.Compare"), "1 matching functions\n")
+	})
+
+	t.Run("callees", func(t *testing.T) {
+		out := exec("callees (*example.com/watchtest/b.Buffer).Reset")
+		assert.Regexp(t, `b\.go:11:28: bytes\.Buffer\.Reset\n$`, out)
+
+		out = exec("callees example.com/watchtest/b.G")
+		assert.Regexp(t, `b\.go:15:12: example\.com/watchtest/a\.F \(import\)\n$`, out)
+
+		assert.Equal(t, "error: function \"example.com/watchtest/b.H\" not found\n",
+			exec("callees example.com/watchtest/b.H"),
+		)
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		writeFile("c/c.go", "package c\n\nimport \"strings\"\n\nfunc H() { strings.Compare(\"a\", \"b\") }\n")
+		assert.Equal(t, "loaded 3 packages\n", exec("reload"))
+		assert.Contains(t, exec("strings.Compare"), "2 matching functions\n")
+	})
+
+	t.Run("exit", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.True(t, r.exec("exit", &out))
+		assert.Empty(t, out.String())
+	})
+}
+
+func TestREPLComplete(t *testing.T) {
+	modDir, writeFile := newWatchModule(t)
+	writeFile("b/b.go", `package b
+
+import "bytes"
+
+type Buffer struct{ buf bytes.Buffer }
+
+func (b *Buffer) Reset() {}
+
+func (b *Buffer) reset() {}
+
+func (b Buffer) Read() {}
+
+func G() { b := bytes.Buffer{}; b.Reset() }
+
+func Xé() {}
+
+func Xè() {}
+`)
+
+	ip, err := parseInteractiveParams(nil)
+	require.NoError(t, err)
+
+	r, err := newREPL(modDir, ip)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		desc       string
+		line       string
+		pos        int
+		newLine    string
+		candidates []string
+	}{
+		{
+			desc:    "command",
+			line:    "tra",
+			newLine: "transitive",
+		},
+		{
+			desc:       "several commands",
+			line:       "s",
+			newLine:    "s",
+			candidates: []string{"sub"},
+		},
+		{
+			desc:    "package path",
+			line:    "find example.com/watchtest/",
+			newLine: "find example.com/watchtest/",
+			candidates: []string{
+				"example.com/watchtest/a",
+				"example.com/watchtest/b",
+			},
+		},
+		{
+			desc:    "dependency package path",
+			line:    "find byt",
+			newLine: "find bytes",
+		},
+		{
+			desc:    "package members",
+			line:    "find example.com/watchtest/b.",
+			newLine: "find example.com/watchtest/b.",
+			candidates: []string{
+				"example.com/watchtest/b.Buffer",
+				"example.com/watchtest/b.G",
+			},
+		},
+		{
+			desc:    "methods",
+			line:    "find example.com/watchtest/b.Buffer.R",
+			newLine: "find example.com/watchtest/b.Buffer.Re",
+			candidates: []string{
+				"example.com/watchtest/b.Buffer.Read",
+				"example.com/watchtest/b.Buffer.Reset",
+			},
+		},
+		{
+			desc:    "unexported methods of analyzed packages",
+			line:    "find example.com/watchtest/b.Buffer.r",
+			newLine: "find example.com/watchtest/b.Buffer.reset",
+		},
+		{
+			desc:    "exported methods of dependencies",
+			line:    "find bytes.Buffer.Res",
+			newLine: "find bytes.Buffer.Reset",
+		},
+		{
+			desc:    "after comma",
+			line:    "strings.Compare,bytes.Buffer.Res",
+			newLine: "strings.Compare,bytes.Buffer.Reset",
+		},
+		{
+			desc:    "in the middle",
+			line:    "find bytes.Buffer.Res, strings.Compare",
+			pos:     len("find bytes.Buffer.Res"),
+			newLine: "find bytes.Buffer.Reset, strings.Compare",
+		},
+		{
+			desc:    "after non-ASCII characters",
+			line:    "find ñ,bytes.Buffer.Res",
+			newLine: "find ñ,bytes.Buffer.Reset",
+		},
+		{
+			desc:    "in the middle after non-ASCII characters",
+			line:    "find ñ, bytes.Buffer.Res, strings.Compare",
+			pos:     len("find ñ, bytes.Buffer.Res"),
+			newLine: "find ñ, bytes.Buffer.Reset, strings.Compare",
+		},
+		{
+			desc:    "common prefix of non-ASCII candidates",
+			line:    "find example.com/watchtest/b.X",
+			newLine: "find example.com/watchtest/b.X",
+			candidates: []string{
+				"example.com/watchtest/b.Xé",
+				"example.com/watchtest/b.Xè",
+			},
+		},
+		{
+			desc:    "no candidates",
+			line:    "find nothing",
+			newLine: "find nothing",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			// the positions are byte offsets, as x/term passes them
+			pos := tc.pos
+			if pos == 0 {
+				pos = len(tc.line)
+			}
+
+			newLine, newPos, candidates := r.complete(tc.line, pos)
+			assert.Equal(t, tc.newLine, newLine)
+			assert.Equal(t, len(tc.newLine)-(len(tc.line)-pos), newPos)
+			if tc.candidates != nil {
+				for _, c := range tc.candidates {
+					assert.Contains(t, candidates, c)
+				}
+			} else {
+				assert.Nil(t, candidates)
+			}
+		})
+	}
+}
+
+func TestRunInteractive(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	stdin := strings.NewReader("help\nfind strings.Compare\nexit\nfind strings.Index\n")
+	code := runInteractive([]string{"./testdata/generated"}, stdin, &stdout, &stderr)
+	require.Equal(t, exitCodeOK, code, stderr.String())
+	assert.Equal(t, "loaded 1 packages, type help for the list of commands\n", stderr.String())
+	assert.True(t, strings.HasPrefix(stdout.String(), interactiveHelp))
+	assert.NotContains(t, stdout.String(), "strings.Index")
+	assert.True(t, strings.HasSuffix(stdout.String(), "0 matching functions\n"))
+
+	code = runInteractive([]string{"-generated", "all"}, strings.NewReader(""), &stdout, &stderr)
+	assert.Equal(t, exitCodeUsage, code)
+}
@@ -0,0 +1,571 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// lspCmd is the name of the subcommand which runs a Language Server Protocol
+// server through the standard input and output.
+const lspCmd = "lsp"
+
+// The LSP error codes used by the server.
+const (
+	lspErrMethodNotFound = -32601
+	lspErrInternal       = -32603
+)
+
+// The LSP diagnostic severities.
+const (
+	lspSeverityError       = 1
+	lspSeverityWarning     = 2
+	lspSeverityInformation = 3
+)
+
+// lspDiagnosticSource is the source of the diagnostics published by the
+// server.
+const lspDiagnosticSource = "findfuncs"
+
+// lspParams are the command line flags and arguments of the lsp subcommand.
+type lspParams struct {
+	cmdp cmdParams
+}
+
+// parseLSPParams parses and maps the command line flags and arguments of the
+// lsp subcommand. inParams is the list of command line arguments after the
+// subcommand name. The packages patterns are "./..." when there isn't any.
+func parseLSPParams(inParams []string) (lspParams, error) {
+	fset := flag.NewFlagSet(lspCmd, flag.ContinueOnError)
+	qflags := addQueryFlags(fset)
+	pflags := addPackagesFlags(fset)
+
+	if err := fset.Parse(inParams); err != nil {
+		return lspParams{}, err
+	}
+
+	pp, err := pflags.params()
+	if err != nil {
+		return lspParams{}, err
+	}
+
+	rules, err := qflags.rules()
+	if err != nil {
+		return lspParams{}, err
+	}
+
+	return lspParams{
+		cmdp: cmdParams{
+			pkgsPatterns: pp.pkgsPatterns,
+			rules:        rules,
+			output:       outputOptions{format: formatText, pathMode: pathDisk, sortBy: sortFile},
+			keepFile:     pp.keepFile,
+			workers:      pp.workers,
+		},
+	}, nil
+}
+
+// runLSP executes the lsp subcommand with args, which are the command line
+// arguments after the subcommand name, serving the requests read from stdin
+// and returns the exit code.
+func runLSP(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	lp, err := parseLSPParams(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitCodeOK
+		}
+
+		fmt.Fprintln(stderr, err)
+		return exitCodeUsage
+	}
+
+	srv := &lspServer{cmdp: lp.cmdp, dir: ".", out: stdout, log: stderr}
+	if err := srv.serve(stdin); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitCodeError
+	}
+
+	return exitCodeOK
+}
+
+// lspMessage is a JSON-RPC message. Requests have ID and Method, notifications
+// only Method and responses only ID.
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *lspError        `json:"error,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Code     string   `json:"code"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspPublishDiagnosticsParams struct {
+	URI         string          `json:"uri"`
+	Diagnostics []lspDiagnostic `json:"diagnostics"`
+}
+
+type lspCommand struct {
+	Title   string `json:"title"`
+	Command string `json:"command"`
+}
+
+type lspCodeLens struct {
+	Range   lspRange   `json:"range"`
+	Command lspCommand `json:"command"`
+}
+
+type lspTextDocumentParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+}
+
+type lspInitializeParams struct {
+	RootURI string `json:"rootUri"`
+}
+
+// lspServer is a Language Server Protocol server which publishes a diagnostic
+// for each function which matches a rule and offers a code lens on each
+// function which calls any of the functions of the rules.
+type lspServer struct {
+	cmdp cmdParams
+	dir  string
+	out  io.Writer
+	log  io.Writer
+	w    *watcher
+	// results are the results of the last evaluation of the rules.
+	results []ruleResult
+	// published are the URIs of the documents with published diagnostics.
+	published map[string]bool
+}
+
+// serve reads the messages from r and handles them until the exit
+// notification is received or r is closed.
+func (s *lspServer) serve(r io.Reader) error {
+	br := bufio.NewReader(r)
+	for {
+		msg, err := readLSPMessage(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return err
+		}
+
+		if msg.Method == "exit" {
+			return nil
+		}
+
+		result, rerr := s.handle(msg)
+		if msg.ID == nil {
+			if rerr != nil {
+				fmt.Fprintf(s.log, "error while handling %s: %s\n", msg.Method, rerr.Message)
+			}
+
+			continue
+		}
+
+		resp := lspMessage{JSONRPC: "2.0", ID: msg.ID, Error: rerr}
+		if rerr == nil {
+			resp.Result = result
+			if result == nil {
+				resp.Result = json.RawMessage("null")
+			}
+		}
+
+		if err := writeLSPMessage(s.out, resp); err != nil {
+			return err
+		}
+	}
+}
+
+// handle handles the request or notification msg and returns the result of
+// the requests.
+func (s *lspServer) handle(msg lspMessage) (interface{}, *lspError) {
+	switch msg.Method {
+	case "initialize":
+		var params lspInitializeParams
+		_ = json.Unmarshal(msg.Params, &params)
+		if dir := uriToFilename(params.RootURI); dir != "" {
+			s.dir = dir
+		}
+
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": map[string]interface{}{"openClose": true, "save": true},
+				"codeLensProvider": map[string]interface{}{"resolveProvider": false},
+			},
+			"serverInfo": map[string]string{"name": "find-funcs-with-set-funcs-calls"},
+		}, nil
+
+	case "initialized":
+		w, results, err := newWatcher(s.dir, s.cmdp)
+		if err != nil {
+			return nil, &lspError{Code: lspErrInternal, Message: err.Error()}
+		}
+
+		tp := newTypesPackages(w.pkgs).withUnimported(s.dir, w.cmdp.rules)
+		for _, msg := range tp.checkRules(w.cmdp.rules) {
+			fmt.Fprintf(s.log, "warning: %s\n", msg)
+		}
+
+		s.w, s.results = w, results
+		if err := s.publishDiagnostics(); err != nil {
+			return nil, &lspError{Code: lspErrInternal, Message: err.Error()}
+		}
+
+		return nil, nil
+
+	case "textDocument/didSave":
+		var params lspTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &lspError{Code: lspErrInternal, Message: err.Error()}
+		}
+
+		if s.w == nil {
+			return nil, nil
+		}
+
+		results, _, err := s.w.update([]string{uriToFilename(params.TextDocument.URI)})
+		if err != nil {
+			return nil, &lspError{Code: lspErrInternal, Message: err.Error()}
+		}
+
+		s.results = results
+		if err := s.publishDiagnostics(); err != nil {
+			return nil, &lspError{Code: lspErrInternal, Message: err.Error()}
+		}
+
+		return nil, nil
+
+	case "textDocument/codeLens":
+		var params lspTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &lspError{Code: lspErrInternal, Message: err.Error()}
+		}
+
+		return s.codeLenses(uriToFilename(params.TextDocument.URI)), nil
+
+	case "shutdown", "textDocument/didOpen", "textDocument/didClose", "textDocument/didChange", "$/cancelRequest":
+		return nil, nil
+
+	default:
+		if msg.ID == nil {
+			// the unknown notifications are ignored
+			return nil, nil
+		}
+
+		return nil, &lspError{Code: lspErrMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+}
+
+// publishDiagnostics publishes the diagnostics of the last results. The
+// documents which had diagnostics and don't have them anymore are published
+// with an empty list for clearing them.
+func (s *lspServer) publishDiagnostics() error {
+	frs, err := funcResults(s.results, false)
+	if err != nil {
+		return err
+	}
+
+	var (
+		byURI = map[string][]lspDiagnostic{}
+		files = lspFiles{}
+	)
+	for _, fr := range frs {
+		msg := fr.Message
+		if msg == "" {
+			msg = fmt.Sprintf("%s matches the rule %s", fr.Func, fr.Rule)
+		}
+
+		uri := filenameToURI(fr.Filename)
+		byURI[uri] = append(byURI[uri], lspDiagnostic{
+			Range:    files.pointRange(fr.Filename, fr.Line, fr.Column),
+			Severity: lspSeverity(fr.Severity),
+			Code:     fr.Rule,
+			Source:   lspDiagnosticSource,
+			Message:  msg,
+		})
+	}
+
+	var uris []string
+	for uri := range byURI {
+		uris = append(uris, uri)
+	}
+	for uri := range s.published {
+		if _, ok := byURI[uri]; !ok {
+			uris = append(uris, uri)
+		}
+	}
+	sort.Strings(uris)
+
+	published := make(map[string]bool, len(byURI))
+	for _, uri := range uris {
+		diags := byURI[uri]
+		if diags == nil {
+			diags = []lspDiagnostic{}
+		} else {
+			published[uri] = true
+		}
+
+		err := writeLSPMessage(s.out, lspMessage{
+			JSONRPC: "2.0",
+			Method:  "textDocument/publishDiagnostics",
+			Params:  mustMarshalJSON(lspPublishDiagnosticsParams{URI: uri, Diagnostics: diags}),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	s.published = published
+	return nil
+}
+
+// codeLenses returns a code lens for each function of the file filename which
+// calls any of the functions of the rules. The title lists the called
+// functions.
+func (s *lspServer) codeLenses(filename string) []lspCodeLens {
+	lenses := []lspCodeLens{}
+	if s.w == nil {
+		return lenses
+	}
+
+	files := lspFiles{}
+	for _, idx := range s.w.idxs {
+		for i := range idx.Files {
+			fi := &idx.Files[i]
+			if fi.Filename != filename {
+				continue
+			}
+
+			for j := range fi.Funcs {
+				called := calledFuncs(idx, &fi.Funcs[j], s.w.cmdp.rules)
+				if len(called) == 0 {
+					continue
+				}
+
+				lenses = append(lenses, lspCodeLens{
+					Range: files.pointRange(fi.Filename, fi.Funcs[j].Pos.Line, fi.Funcs[j].Pos.Column),
+					Command: lspCommand{
+						Title: "calls " + strings.Join(called, ", "),
+					},
+				})
+			}
+		}
+	}
+
+	return lenses
+}
+
+// calledFuncs returns the names, with the format of the -funcs flag, of the
+// funcCalls of rules which fn, declared in idx, calls. The funcCalls are
+// matched as findRule does, so only the rules which apply to idx are used and
+// the calls through function values, the promoted methods and the references
+// only match for the rules which have the corresponding option.
+func calledFuncs(idx *pkgIndex, fn *funcIndex, rules []rule) []string {
+	var (
+		called []string
+		seen   = map[string]bool{}
+	)
+	for _, r := range rules {
+		if !r.appliesTo(idx.PkgPath) {
+			continue
+		}
+
+		opts := findOptions{indirect: r.indirect, promoted: r.promoted, refs: r.refs}
+		for _, fc := range r.funcCalls {
+			name := funcCallName(fc)
+			if seen[name] {
+				continue
+			}
+
+			if fc.pkg == analyzedPkg {
+				fc.pkg = idx.PkgPath
+			}
+
+			if direct, indirect, referenced, _ := matchFunc(idx, fn, fc, opts); direct || indirect || referenced {
+				seen[name] = true
+				called = append(called, name)
+			}
+		}
+	}
+
+	return called
+}
+
+// funcCallName returns fc with the format of the -funcs flag. The package
+// path is quoted when its last element contains a dot, so the short form
+// would be parsed as a different package.
+func funcCallName(fc funcCall) string {
+	pkg := fc.pkg
+	switch {
+	case pkg == analyzedPkg:
+		pkg = ""
+	case strings.Contains(pkg[strings.LastIndex(pkg, "/")+1:], "."):
+		pkg = strconv.Quote(pkg)
+	}
+
+	switch {
+	case fc.receiver == "":
+		return pkg + "." + fc.funcName
+	case fc.recvKind == recvValue:
+		return "(" + pkg + "." + fc.receiver + ")." + fc.funcName
+	case fc.recvKind == recvPointer:
+		return "(*" + pkg + "." + fc.receiver + ")." + fc.funcName
+	default:
+		return pkg + "." + fc.receiver + "." + fc.funcName
+	}
+}
+
+// lspFiles are the lines of the files, by their name, which are read for
+// converting the columns of the positions into LSP characters.
+type lspFiles map[string][]string
+
+// pointRange returns an empty range at the 1-based line and column, in bytes,
+// of the file filename. The LSP characters are UTF-16 code units, so the
+// column is converted from the content of the line, which is read once per
+// file. The column is used as it is when the file cannot be read, e.g. because
+// the position comes from a //line directive. An unknown column is the
+// beginning of the line.
+func (lf lspFiles) pointRange(filename string, line int, column int) lspRange {
+	pos := lspPosition{Line: line - 1}
+	if column <= 0 {
+		return lspRange{Start: pos, End: pos}
+	}
+
+	lines, ok := lf[filename]
+	if !ok {
+		if data, err := os.ReadFile(filename); err == nil {
+			lines = strings.Split(string(data), "\n")
+		}
+		lf[filename] = lines
+	}
+
+	pos.Character = column - 1
+	if line >= 1 && line <= len(lines) && column-1 <= len(lines[line-1]) {
+		pos.Character = len(utf16.Encode([]rune(lines[line-1][:column-1])))
+	}
+
+	return lspRange{Start: pos, End: pos}
+}
+
+// lspSeverity returns the LSP diagnostic severity of the rule severity.
+func lspSeverity(severity string) int {
+	switch severity {
+	case severityError:
+		return lspSeverityError
+	case severityInfo:
+		return lspSeverityInformation
+	default:
+		return lspSeverityWarning
+	}
+}
+
+// uriToFilename returns the path of the file URI uri. It returns an empty
+// string if uri isn't a file URI.
+func uriToFilename(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+
+	return filepath.FromSlash(u.Path)
+}
+
+// filenameToURI returns the file URI of the absolute path filename.
+func filenameToURI(filename string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(filename)}).String()
+}
+
+// readLSPMessage reads a message with its Content-Length header from r.
+func readLSPMessage(r *bufio.Reader) (lspMessage, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return lspMessage{}, io.EOF
+		}
+
+		return lspMessage{}, fmt.Errorf("error while reading LSP message header: %v", err)
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return lspMessage{}, fmt.Errorf("invalid LSP message Content-Length header: %v", err)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return lspMessage{}, fmt.Errorf("error while reading LSP message: %v", err)
+	}
+
+	var msg lspMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return lspMessage{}, fmt.Errorf("invalid LSP message: %v", err)
+	}
+
+	return msg, nil
+}
+
+// writeLSPMessage writes msg with its Content-Length header to w.
+func writeLSPMessage(w io.Writer, msg lspMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error while encoding LSP message: %v", err)
+	}
+
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		return fmt.Errorf("error while writing LSP message: %v", err)
+	}
+
+	return nil
+}
+
+// mustMarshalJSON returns v encoded in JSON. It panics if v cannot be encoded,
+// so it must only be used with types which are always encodable.
+func mustMarshalJSON(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+
+	return data
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lspTestClient sends messages to an lspServer and reads the ones which it
+// sends back.
+type lspTestClient struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    *bufio.Reader
+	served chan error
+}
+
+func newLSPTestClient(t *testing.T, srv *lspServer) *lspTestClient {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	srv.out = outW
+
+	c := &lspTestClient{t: t, in: inW, out: bufio.NewReader(outR), served: make(chan error, 1)}
+	go func() {
+		c.served <- srv.serve(inR)
+		_ = outW.Close()
+	}()
+
+	return c
+}
+
+func (c *lspTestClient) send(id int, method string, params interface{}) {
+	c.t.Helper()
+	msg := lspMessage{JSONRPC: "2.0", Method: method, Params: mustMarshalJSON(params)}
+	if id > 0 {
+		rawID := json.RawMessage(mustMarshalJSON(id))
+		msg.ID = &rawID
+	}
+
+	require.NoError(c.t, writeLSPMessage(c.in, msg))
+}
+
+func (c *lspTestClient) receive(v interface{}) lspMessage {
+	c.t.Helper()
+	msg, err := readLSPMessage(c.out)
+	require.NoError(c.t, err)
+
+	var raw struct {
+		Result json.RawMessage `json:"result"`
+		Params json.RawMessage `json:"params"`
+	}
+	data, err := json.Marshal(msg)
+	require.NoError(c.t, err)
+	require.NoError(c.t, json.Unmarshal(data, &raw))
+
+	if v != nil {
+		payload := raw.Result
+		if msg.Method != "" {
+			payload = raw.Params
+		}
+		require.NoError(c.t, json.Unmarshal(payload, v), "message: %s", data)
+	}
+
+	return msg
+}
+
+func lspPoint(line int, character int) lspRange {
+	pos := lspPosition{Line: line, Character: character}
+	return lspRange{Start: pos, End: pos}
+}
+
+func TestLSPServer(t *testing.T) {
+	modDir, writeFile := newWatchModule(t)
+
+	lp, err := parseLSPParams([]string{"-funcs", "strings.Compare,path/filepath.Join"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"./..."}, lp.cmdp.pkgsPatterns)
+
+	c := newLSPTestClient(t, &lspServer{cmdp: lp.cmdp, log: io.Discard})
+	aURI := filenameToURI(filepath.Join(modDir, "a", "a.go"))
+
+	c.send(1, "initialize", map[string]string{"rootUri": filenameToURI(modDir)})
+	var initResult struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	c.receive(&initResult)
+	assert.Contains(t, initResult.Capabilities, "codeLensProvider")
+
+	// The rule needs both functions, so F doesn't match until it calls both.
+	writeFile("a/a.go", `package a
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+func F() { strings.Compare(filepath.Join("a", "b"), "c") }
+
+func G() { strings.Compare("a", "b") }
+`)
+	c.send(0, "initialized", struct{}{})
+	var diags lspPublishDiagnosticsParams
+	msg := c.receive(&diags)
+	assert.Equal(t, "textDocument/publishDiagnostics", msg.Method)
+	assert.Equal(t, aURI, diags.URI)
+	assert.Equal(t, []lspDiagnostic{{
+		Range:    lspPoint(7, 0),
+		Severity: lspSeverityWarning,
+		Code:     defaultRuleName,
+		Source:   lspDiagnosticSource,
+		Message:  "F matches the rule default",
+	}}, diags.Diagnostics)
+
+	c.send(2, "textDocument/codeLens", map[string]interface{}{"textDocument": map[string]string{"uri": aURI}})
+	var lenses []lspCodeLens
+	c.receive(&lenses)
+	assert.Equal(t, []lspCodeLens{
+		{Range: lspPoint(7, 0), Command: lspCommand{Title: "calls strings.Compare, path/filepath.Join"}},
+		{Range: lspPoint(9, 0), Command: lspCommand{Title: "calls strings.Compare"}},
+	}, lenses)
+
+	writeFile("a/a.go", "package a\n\nimport \"strings\"\n\nfunc F() { strings.Compare(\"a\", \"b\") }\n")
+	c.send(0, "textDocument/didSave", map[string]interface{}{"textDocument": map[string]string{"uri": aURI}})
+	diags = lspPublishDiagnosticsParams{}
+	c.receive(&diags)
+	assert.Equal(t, aURI, diags.URI)
+	assert.Empty(t, diags.Diagnostics)
+
+	c.send(3, "unknown/method", struct{}{})
+	msg = c.receive(nil)
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, lspErrMethodNotFound, msg.Error.Code)
+
+	c.send(4, "shutdown", nil)
+	msg = c.receive(nil)
+	assert.Nil(t, msg.Error)
+
+	c.send(0, "exit", nil)
+	require.NoError(t, <-c.served)
+}
+
+func TestURIFilename(t *testing.T) {
+	filename := filepath.Join(string(filepath.Separator)+"src", "my project", "a.go")
+	uri := filenameToURI(filename)
+	assert.Equal(t, "file:///src/my%20project/a.go", uri)
+	assert.Equal(t, filename, uriToFilename(uri))
+	assert.Empty(t, uriToFilename("untitled:Untitled-1"))
+}
+
+func TestFuncCallName(t *testing.T) {
+	for _, ref := range []string{
+		"strings.Compare",
+		"net/http.Client.Do",
+		`"gopkg.in/yaml.v3".Unmarshal`,
+		`"github.com/x/go.uuid".UUID.String`,
+		"(*net/http.Client).Do",
+		"(bytes.Buffer).Len",
+		`("github.com/x/go.uuid".UUID).String`,
+		"(*.Client).Close",
+	} {
+		fcs, err := parseFuncCalls(ref)
+		require.NoError(t, err)
+		assert.Equal(t, ref, funcCallName(fcs[0]))
+	}
+}
+
+func TestParseLSPParams(t *testing.T) {
+	lp, err := parseLSPParams([]string{"-funcs", "strings.Compare", "-j", "2", "./a"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"./a"}, lp.cmdp.pkgsPatterns)
+	assert.Equal(t, 2, lp.cmdp.workers)
+
+	_, err = parseLSPParams([]string{"-funcs", "strings.Compare", "-j", "-1"})
+	require.Error(t, err)
+}
+
+func TestLSPFilesPointRange(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "a.go")
+	require.NoError(t, os.WriteFile(filename, []byte("package a\n\nvar s = \"ñ😀\"; func F() {}\n"), 0o644))
+
+	files := lspFiles{}
+	assert.Equal(t, lspPoint(2, 0), files.pointRange(filename, 3, 0))
+	assert.Equal(t, lspPoint(2, 4), files.pointRange(filename, 3, 5))
+	// "ñ" is 2 bytes and 1 code unit and "😀" 4 bytes and 2 code units
+	assert.Equal(t, lspPoint(2, 15), files.pointRange(filename, 3, 19))
+	assert.Equal(t, lspPoint(9, 7), files.pointRange(filename, 10, 8), "line out of the file")
+	assert.Equal(t, lspPoint(0, 7), files.pointRange("missing.go", 1, 8), "file which cannot be read")
+}
+
+func TestCalledFuncs(t *testing.T) {
+	const pkgPath = "example.com/a"
+
+	idx := &pkgIndex{PkgPath: pkgPath}
+	fn := &funcIndex{
+		ID: "F",
+		Callees: []callee{
+			{Kind: calleeImport, Pkg: "strings", Name: "Compare", Indirect: true},
+			{Kind: calleeImport, Pkg: "bytes", Name: "Equal"},
+		},
+		Refs: []callee{{Kind: calleeImport, Pkg: "strings", Name: "Index"}},
+	}
+
+	fcalls, err := parseFuncCalls("strings.Compare,bytes.Equal,strings.Index")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		desc     string
+		rules    []rule
+		expected []string
+	}{
+		{
+			desc:     "only direct calls",
+			rules:    []rule{{funcCalls: fcalls}},
+			expected: []string{"bytes.Equal"},
+		},
+		{
+			desc:     "indirect",
+			rules:    []rule{{funcCalls: fcalls, indirect: true}},
+			expected: []string{"strings.Compare", "bytes.Equal"},
+		},
+		{
+			desc:     "refs",
+			rules:    []rule{{funcCalls: fcalls, refs: true}},
+			expected: []string{"bytes.Equal", "strings.Index"},
+		},
+		{
+			desc:     "several rules",
+			rules:    []rule{{funcCalls: fcalls}, {funcCalls: fcalls, indirect: true, refs: true}},
+			expected: []string{"bytes.Equal", "strings.Compare", "strings.Index"},
+		},
+		{
+			desc:  "rule which doesn't apply",
+			rules: []rule{{funcCalls: fcalls, indirect: true, refs: true, exclude: []string{pkgPath}}},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.expected, calledFuncs(idx, fn, tc.rules))
+		})
+	}
+}
@@ -9,161 +9,763 @@ import (
 	"fmt"
 	"go/ast"
 	"go/token"
-	"go/types"
-	"log"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
-	"golang.org/x/tools/go/ast/astutil"
 	"golang.org/x/tools/go/packages"
 )
 
+// The exit codes returned by the command. They allow to use the tool as a
+// policy check in CI pipelines.
+const (
+	// exitCodeOK is returned when the command ran successfully and the results
+	// didn't exceed any of the indicated limits.
+	exitCodeOK = 0
+	// exitCodeError is returned when the command failed, e.g. packages couldn't
+	// be loaded.
+	exitCodeError = 1
+	// exitCodeUsage is returned when the command line flags or arguments are
+	// invalid.
+	exitCodeUsage = 2
+	// exitCodeMatches is returned when some function matches and -fail-on-match
+	// is set or the number of matches exceeds -max-matches.
+	exitCodeMatches = 3
+)
+
 func main() {
-	cmdp, err := params(os.Args[1:])
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command with args, which are the command line arguments
+// without the program name, and returns the exit code.
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case historyCmd:
+			return runHistory(args[1:], stdout, stderr)
+		case lspCmd:
+			return runLSP(args[1:], os.Stdin, stdout, stderr)
+		case serveCmd:
+			return runServe(args[1:], stdout, stderr)
+		case interactiveCmd:
+			return runInteractive(args[1:], os.Stdin, stdout, stderr)
+		}
+	}
+
+	cmdp, err := params(args)
 	if err != nil {
-		log.Fatal(err)
+		if errors.Is(err, flag.ErrHelp) {
+			return exitCodeOK
+		}
+
+		fmt.Fprintln(stderr, err)
+		return exitCodeUsage
 	}
 
-	subsets := createSubsets(cmdp.funcCalls, cmdp.subsetsOf)
+	if cmdp.watch {
+		return runWatch(".", cmdp, stdout, stderr, interruptChan())
+	}
 
-	var allFuncsFiles []funcsByFile
-	for _, funcCalls := range subsets {
-		funcFiles, err := find(cmdp.pkgsPatterns, funcCalls)
+	var keepFunc funcFilter
+	if cmdp.diff != "" {
+		var (
+			dl  diffLines
+			err error
+		)
+		if cmdp.diff == "-" {
+			dl, err = readDiffLines(os.Stdin, ".")
+		} else {
+			dl, err = gitDiffLines(".", cmdp.diff)
+		}
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			fmt.Fprintln(stderr, err)
+			return exitCodeError
 		}
 
-		allFuncsFiles = mergeFuncsByFiles(allFuncsFiles, funcFiles)
+		keepFunc = dl.funcFilter()
+	}
+
+	idxs, tp, err := loadIndexes("", cmdp.pkgsPatterns, cmdp.cacheDir, cmdp.indexOptions(), cmdp.workers)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitCodeError
+	}
+
+	cmdp.rules, err = resolvePkgNames(cmdp.rules, idxs, tp)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitCodeUsage
+	}
+
+	sups, warns := collectSuppressions(idxs, cmdp.keepFile)
+	warns = append(tp.withUnimported("", cmdp.rules).checkRules(cmdp.rules), warns...)
+	results := make([]ruleResult, len(cmdp.rules))
+	for i, r := range cmdp.rules {
+		funcsFiles := findRule(idxs, r, sups, findOptions{
+			keepFunc: keepFunc,
+			keepFile: cmdp.keepFile,
+		})
+		results[i] = ruleResult{rule: r, funcsFiles: funcsFiles}
+	}
+
+	var goneEntries []baselineEntry
+	switch cmdp.baselineMode {
+	case baselineModeWrite:
+		if err := writeBaseline(cmdp.baselineFile, results); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitCodeError
+		}
+	case baselineModeCheck:
+		bl, err := readBaseline(cmdp.baselineFile)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitCodeError
+		}
+
+		results, goneEntries = bl.check(results)
+	}
+
+	if err := printResults(stdout, cmdp.output, results); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitCodeError
+	}
+
+	for _, w := range append(warns, sups.unused(cmdp.rules, cmdp.configRules)...) {
+		fmt.Fprintf(stderr, "warning: %s\n", w)
+	}
+
+	for _, e := range goneEntries {
+		fmt.Fprintf(stderr, "warning: baseline entry doesn't match anymore: %s\n", e)
+	}
+
+	if cmdp.baselineMode == baselineModeWrite {
+		return exitCodeOK
+	}
+
+	var numMatches int
+	for _, rr := range results {
+		numMatches += countMatches(rr.funcsFiles)
+	}
+
+	return checkMatches(cmdp, numMatches, stderr)
+}
+
+// checkMatches returns the exit code which corresponds to numMatches
+// according to the limits set in cmdp, reporting to w when they are exceeded.
+func checkMatches(cmdp cmdParams, numMatches int, w io.Writer) int {
+	if cmdp.failOnMatch && numMatches > 0 {
+		fmt.Fprintf(w, "found %d matching functions\n", numMatches)
+		return exitCodeMatches
+	}
+
+	if cmdp.maxMatches >= 0 && numMatches > cmdp.maxMatches {
+		fmt.Fprintf(w, "found %d matching functions, maximum allowed is %d\n",
+			numMatches, cmdp.maxMatches,
+		)
+		return exitCodeMatches
+	}
+
+	return exitCodeOK
+}
+
+// countMatches returns the total number of functions in funcsFiles.
+func countMatches(funcsFiles []funcsByFile) int {
+	var n int
+	for _, fbf := range funcsFiles {
+		n += len(fbf.FuncNames)
 	}
 
-	fmt.Println(allFuncsFiles)
+	return n
+}
+
+// indexOptions returns the options which build the indexes required by the
+// rules of cmdp.
+func (cmdp cmdParams) indexOptions() indexOptions {
+	return indexOptions{backend: cmdp.backend, indirect: indirectRules(cmdp.rules)}
 }
 
 type cmdParams struct {
 	pkgsPatterns []string
-	funcCalls    []funcCall
-	subsetsOf    uint
+	rules        []rule
+	// configRules indicates that the rules are read from a configuration
+	// file, so they are all the rules of the project.
+	configRules bool
+	failOnMatch bool
+	output      outputOptions
+	// maxMatches is the maximum number of matching functions allowed. A
+	// negative value means no limit.
+	maxMatches int
+	// baselineMode is empty when no baseline is used, otherwise
+	// baselineModeWrite or baselineModeCheck.
+	baselineMode string
+	baselineFile string
+	// diff is the git revision to compare the working tree with for only
+	// reporting the functions changed since then. "-" means to read a unified
+	// diff from the standard input and empty means no filtering.
+	diff string
+	// keepFile is the filter of the files to analyze. nil means all the files.
+	keepFile fileFilter
+	// workers is the maximum number of packages analyzed concurrently. Zero
+	// means the number of CPUs.
+	workers int
+	// backend is the backend which resolves the calls, backendAST or
+	// backendSSA.
+	backend string
+	// cacheDir is the directory where the indexes of the packages are cached.
+	// Empty means no cache.
+	cacheDir string
+	// watch indicates to keep running and report the matches which change when
+	// the files of the packages change.
+	watch bool
 }
 
 type funcCall struct {
 	pkg      string
 	receiver string
 	funcName string
+	// recvKind is the kind of receiver which the method is called through,
+	// recvEither, recvValue or recvPointer. It's recvEither when receiver is
+	// empty.
+	recvKind string
 }
 
+// The kinds of receiver of the methods of the function calls.
+const (
+	// recvEither is any receiver, e.g. "pkg.T.Method".
+	recvEither = ""
+	// recvValue is a value of the type, e.g. "(pkg.T).Method", which only
+	// has the methods declared with a value receiver.
+	recvValue = "value"
+	// recvPointer is a pointer to the type, e.g. "(*pkg.T).Method", which has
+	// the methods declared with a pointer receiver and the ones declared with
+	// a value receiver when they are called through a pointer.
+	recvPointer = "pointer"
+)
+
 type funcsByFile struct {
-	Filename  string
+	PkgPath string
+	// Module is the path of the module which contains the package. It's empty
+	// if the package doesn't belong to a module.
+	Module string
+	// Filename is the absolute path of the file on disk.
+	Filename string
+	// ModuleFilename is the path of the file relative to the module root
+	// directory. It's empty if the package doesn't belong to a module.
+	ModuleFilename string
+	// Generated indicates that the file has the standard comment which marks
+	// the generated files.
+	Generated bool
+	// FuncNames are the identifiers of the functions, which are unique inside of
+	// the package, e.g. "Func", "Type.Method" or "*Type.Method".
 	FuncNames []string
+	// SuppressedFuncNames are the functions which match but they are suppressed
+	// by a comment.
+	SuppressedFuncNames []string
+	// RefFuncNames are the functions of FuncNames and SuppressedFuncNames which
+	// only match because they reference, without calling, some of the
+	// functions, e.g. passing them as a function value.
+	RefFuncNames []string
+	// IndirectFuncNames are the functions of FuncNames and SuppressedFuncNames
+	// which only match because they may call some of the functions through a
+	// function value, e.g. a struct field of a function type.
+	IndirectFuncNames []string
+	// FuncPos are the positions of the functions of FuncNames and
+	// SuppressedFuncNames.
+	FuncPos map[string]funcPos
+}
+
+// ruleResult holds the functions which match a rule classified by Go source
+// filepath.
+type ruleResult struct {
+	rule       rule
+	funcsFiles []funcsByFile
 }
 
 // params parses and maps the command line flags and arguments. inParams is the
 // list of command line arguments without the program name.
 func params(inParams []string) (cmdParams, error) {
-	fset := flag.NewFlagSet("", flag.ExitOnError)
-	funcs := fset.String("funcs", "",
-		"the list of the functions to find where are all called inside of a function. It's a comma separated list of: pkg.[type.].func",
+	fset := flag.NewFlagSet("", flag.ContinueOnError)
+	qflags := addQueryFlags(fset)
+	reportSuppressed := fset.Bool("report-suppressed", false,
+		fmt.Sprintf("also report the functions suppressed by a '%s <rule> <reason>' comment", suppressionDirective),
+	)
+	baselineMode := fset.String("baseline", "",
+		fmt.Sprintf(
+			"%q or %q the baseline file passed with -baseline-file. Check only reports the functions which aren't in the baseline.",
+			baselineModeWrite, baselineModeCheck,
+		),
+	)
+	baselineFile := fset.String("baseline-file", "", "the path of the baseline file. It's required when baseline is set")
+	diff := fset.String("diff", "",
+		"only report the functions changed since this git revision. Use - for reading a unified diff from the standard input",
+	)
+	format := fset.String("format", formatText,
+		fmt.Sprintf("the output format: %s or %s", formatText, formatJSON),
 	)
-	subsetsOf := fset.Uint("sub", 0,
-		"search for functions which any subset of functions calls of the indicated number. 0 is not subsets.",
+	pathMode := fset.String("path", pathModule,
+		fmt.Sprintf(
+			"how the file paths are displayed in the %s format: %s (absolute path), %s (relative to the module root) or %s (adjusted by //line directives)",
+			formatText, pathDisk, pathModule, pathLine,
+		),
+	)
+	sortBy := fset.String("sort", sortFile,
+		fmt.Sprintf(
+			"the order of the reported functions: %s, %s, %s (qualified name) or %s (files with more matching functions first)",
+			sortFile, sortPackage, sortFunc, sortMatches,
+		),
+	)
+	failOnMatch := fset.Bool("fail-on-match", false,
+		fmt.Sprintf("exit with code %d when any function matches", exitCodeMatches),
+	)
+	generated := fset.String("generated", generatedInclude,
+		fmt.Sprintf(
+			"how the files with a '// Code generated ... DO NOT EDIT.' comment are handled: %s, %s or %s",
+			generatedSkip, generatedInclude, generatedOnly,
+		),
+	)
+	excludeFiles := fset.String("exclude-files", "",
+		"comma separated list of file path patterns which aren't analyzed, e.g. *.pb.go,internal/**/mocks/*.go. Patterns without slash match the file name, otherwise the path relative to the module root",
+	)
+	cacheDir := fset.String("cache", "",
+		"the directory where the analysis of the packages is cached, so the unchanged packages aren't loaded again in the next runs. Empty is no cache.",
+	)
+	watch := fset.Bool("watch", false,
+		"keep running and report the matches which are added and removed when the files of the packages change",
+	)
+	workers := fset.Int("j", 0,
+		"the maximum number of packages analyzed concurrently. 0 is the number of CPUs.",
+	)
+	backend := fset.String("backend", backendAST,
+		fmt.Sprintf(
+			"how the calls of the functions are resolved: %s (syntax tree and type information) or %s (SSA form)",
+			backendAST, backendSSA,
+		),
+	)
+	maxMatches := fset.Int("max-matches", -1,
+		fmt.Sprintf(
+			"exit with code %d when the number of matching functions exceeds this value. A negative value is no limit.",
+			exitCodeMatches,
+		),
 	)
 
 	if err := fset.Parse(inParams); err != nil {
 		return cmdParams{}, err
 	}
 
-	if *funcs == "" {
-		return cmdParams{}, errors.New("funcs argument is required and it cannot be empty")
+	if *format != formatText && *format != formatJSON {
+		return cmdParams{}, fmt.Errorf(
+			"invalid format %q, valid ones are: %s, %s", *format, formatText, formatJSON,
+		)
 	}
 
-	fcalls, err := parseFuncCalls(*funcs)
+	switch *pathMode {
+	case pathDisk, pathModule, pathLine:
+	default:
+		return cmdParams{}, fmt.Errorf(
+			"invalid path %q, valid ones are: %s, %s, %s", *pathMode, pathDisk, pathModule, pathLine,
+		)
+	}
+
+	var exclude []string
+	for _, p := range strings.Split(*excludeFiles, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			exclude = append(exclude, p)
+		}
+	}
+
+	if *workers < 0 {
+		return cmdParams{}, fmt.Errorf("invalid j value %d, it cannot be negative", *workers)
+	}
+
+	if *backend != backendAST && *backend != backendSSA {
+		return cmdParams{}, fmt.Errorf(
+			"invalid backend %q, valid ones are: %s, %s", *backend, backendAST, backendSSA,
+		)
+	}
+
+	keepFile, err := newFileFilter(*generated, exclude)
+	if err != nil {
+		return cmdParams{}, err
+	}
+
+	if err := validateSortBy(*sortBy); err != nil {
+		return cmdParams{}, err
+	}
+
+	pkgsPatterns := fset.Args()
+	switch *baselineMode {
+	case "":
+	case baselineModeWrite, baselineModeCheck:
+		if *baselineFile == "" {
+			return cmdParams{}, errors.New("baseline-file is required when baseline is set")
+		}
+	default:
+		return cmdParams{}, fmt.Errorf(
+			"invalid baseline value %q, valid ones are: %s, %s", *baselineMode, baselineModeWrite, baselineModeCheck,
+		)
+	}
+
+	if *watch && (*baselineMode != "" || *diff != "") {
+		return cmdParams{}, errors.New("watch cannot be used with baseline nor diff")
+	}
+
+	rules, err := qflags.rules()
 	if err != nil {
 		return cmdParams{}, err
 	}
 
 	return cmdParams{
-		pkgsPatterns: fset.Args(),
-		funcCalls:    fcalls,
-		subsetsOf:    *subsetsOf,
+		pkgsPatterns: pkgsPatterns,
+		rules:        rules,
+		configRules:  *qflags.configFile != "",
+		failOnMatch:  *failOnMatch,
+		output: outputOptions{
+			format:         *format,
+			pathMode:       *pathMode,
+			sortBy:         *sortBy,
+			withSuppressed: *reportSuppressed,
+		},
+		maxMatches:   *maxMatches,
+		baselineMode: *baselineMode,
+		baselineFile: *baselineFile,
+		diff:         *diff,
+		keepFile:     keepFile,
+		workers:      *workers,
+		backend:      *backend,
+		cacheDir:     *cacheDir,
+		watch:        *watch,
 	}, nil
 }
 
-func parseFuncCalls(funcCallsFlagVal string) ([]funcCall, error) {
-	funcCallsVals := strings.Split(funcCallsFlagVal, ",")
+// queryFlags are the command line flags which define the rules to apply.
+type queryFlags struct {
+	funcs      *string
+	subsetsOf  *uint
+	promoted   *bool
+	refs       *bool
+	indirect   *bool
+	configFile *string
+}
 
-	funcCalls := make([]funcCall, len(funcCallsVals))
-	for i, val := range funcCallsVals {
-		var (
-			fcv = strings.TrimSpace(val)
-			pkg string
-		)
-		fpi := strings.LastIndex(fcv, "/")
-		if fpi >= 0 {
-			if fpi == (len(fcv) - 1) {
+// addQueryFlags defines the query flags in fset.
+func addQueryFlags(fset *flag.FlagSet) queryFlags {
+	return queryFlags{
+		funcs: fset.String("funcs", "",
+			"the list of the functions to find where are all called inside of a function. "+
+				`It's a comma separated list of: pkg.[type.].func, "pkg".[type.].func or ([*]pkg.type).func`,
+		),
+		subsetsOf: fset.Uint("sub", 0,
+			"search for functions which any subset of functions calls of the indicated number. 0 is not subsets.",
+		),
+		promoted: fset.Bool("promoted", false,
+			"also match the calls to the methods promoted through embedded fields by the type which embeds them, e.g. T.Reset when T embeds bytes.Buffer",
+		),
+		refs: fset.Bool("refs", false,
+			"also match the references to the functions which aren't calls, e.g. method values, method expressions or functions passed as arguments. They are reported apart.",
+		),
+		indirect: fset.Bool("indirect", false,
+			"also match the calls through function values, e.g. struct fields or variables of a function type, to the functions which they may call. They are reported apart.",
+		),
+		configFile: fset.String("config", "",
+			"the path of a JSON configuration file with a list of named rules. They are applied in addition to funcs.",
+		),
+	}
+}
+
+// packagesFlags are the command line flags of the subcommands which define
+// the packages to analyze and how.
+type packagesFlags struct {
+	fset      *flag.FlagSet
+	generated *string
+	workers   *int
+}
+
+// packagesParams are the packages to analyze and how, defined by the
+// packages flags and the arguments.
+type packagesParams struct {
+	pkgsPatterns []string
+	keepFile     fileFilter
+	workers      int
+}
+
+// addPackagesFlags defines the packages flags in fset.
+func addPackagesFlags(fset *flag.FlagSet) packagesFlags {
+	return packagesFlags{
+		fset: fset,
+		generated: fset.String("generated", generatedInclude,
+			fmt.Sprintf(
+				"how the files with a '// Code generated ... DO NOT EDIT.' comment are handled: %s, %s or %s",
+				generatedSkip, generatedInclude, generatedOnly,
+			),
+		),
+		workers: fset.Int("j", 0,
+			"the maximum number of packages analyzed concurrently. 0 is the number of CPUs.",
+		),
+	}
+}
+
+// params validates the packages flags and returns them with the packages
+// patterns, which are the arguments of the flag set or "./..." when there
+// isn't any. It must be called after parsing the flag set.
+func (pf packagesFlags) params() (packagesParams, error) {
+	keepFile, err := newFileFilter(*pf.generated, nil)
+	if err != nil {
+		return packagesParams{}, err
+	}
+
+	if *pf.workers < 0 {
+		return packagesParams{}, fmt.Errorf("invalid j value %d, it cannot be negative", *pf.workers)
+	}
+
+	pkgsPatterns := pf.fset.Args()
+	if len(pkgsPatterns) == 0 {
+		pkgsPatterns = []string{"./..."}
+	}
+
+	return packagesParams{pkgsPatterns: pkgsPatterns, keepFile: keepFile, workers: *pf.workers}, nil
+}
+
+// rules returns the rules defined by the funcs flag and the ones of the
+// configuration file. At least one of them must be set.
+func (qf queryFlags) rules() ([]rule, error) {
+	if *qf.funcs == "" && *qf.configFile == "" {
+		return nil, errors.New("funcs or config argument is required and it cannot be empty")
+	}
+
+	var rules []rule
+	if *qf.funcs != "" {
+		fcalls, err := parseFuncCalls(*qf.funcs)
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rule{
+			name:      defaultRuleName,
+			severity:  severityWarning,
+			funcCalls: fcalls,
+			subsetsOf: *qf.subsetsOf,
+			promoted:  *qf.promoted,
+			refs:      *qf.refs,
+			indirect:  *qf.indirect,
+		})
+	}
+
+	if *qf.configFile != "" {
+		cfgRules, err := readConfig(*qf.configFile)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range cfgRules {
+			if r.name == defaultRuleName && *qf.funcs != "" {
 				return nil, fmt.Errorf(
-					"Invalid function call reference, format is '<pkg path>.[<<type name>>.]<<func name>>'. Got: %q (from: %q)",
-					val, funcCallsFlagVal,
+					"rule name %q is reserved for the funcs argument", defaultRuleName,
 				)
 			}
-
-			pkg = fcv[:fpi+1]
-			fcv = fcv[fpi+1:]
 		}
 
-		fpi = strings.Index(fcv, ".")
-		if fpi < 0 || fpi == (len(fcv)-1) {
+		rules = append(rules, cfgRules...)
+	}
+
+	return rules, nil
+}
+
+// parseFuncCalls parses the comma separated list of function references of
+// the funcs flag. Each reference has one of the forms:
+//
+//	pkg.func, pkg.type.func         the short form, where pkg is the package
+//	                                path up to the first dot after its last
+//	                                slash.
+//	"pkg".func, "pkg".type.func     the package path is quoted, so it can
+//	                                contain dots in its last element, e.g.
+//	                                "gopkg.in/yaml.v3".Unmarshal.
+//	(pkg.type).func, (*pkg.type).func
+//	                                the methods as types.Func.FullName
+//	                                returns them, where pkg can be quoted too.
+//
+// pkg can be the name of a package instead of its path, which is resolved by
+// resolvePkgNames, and it's omitted for referring to the package being
+// analyzed, e.g. ".func", ".type.func" or "(*.type).func".
+func parseFuncCalls(funcCallsFlagVal string) ([]funcCall, error) {
+	funcCallsVals := strings.Split(funcCallsFlagVal, ",")
+
+	funcCalls := make([]funcCall, len(funcCallsVals))
+	for i, val := range funcCallsVals {
+		fc, ok := parseFuncCall(strings.TrimSpace(val))
+		if !ok {
 			return nil, fmt.Errorf(
-				"Invalid function call reference, format is '<pkg path>.[<<type name>>.]<<func name>>'. Got: %q (from: %q)",
+				"Invalid function call reference, format is '<pkg path>.[<<type name>>.]<<func name>>', "+
+					"'\"<pkg path>\".[<<type name>>.]<<func name>>' or '([*]<pkg path>.<<type name>>).<<func name>>'. "+
+					"Got: %q (from: %q)",
 				val, funcCallsFlagVal,
 			)
 		}
 
-		pkg = fmt.Sprintf("%s%s", pkg, fcv[0:fpi])
-		fcv = fcv[fpi+1:]
+		funcCalls[i] = fc
+	}
+
+	return funcCalls, nil
+}
+
+// parseFuncCall parses a function reference with any of the forms accepted
+// by parseFuncCalls. It returns false if ref is malformed.
+func parseFuncCall(ref string) (funcCall, bool) {
+	var fc funcCall
+	switch {
+	case strings.HasPrefix(ref, "("):
+		end := strings.LastIndex(ref, ").")
+		if end < 0 {
+			return funcCall{}, false
+		}
 
+		recv := ref[1:end]
+		fc.recvKind = recvValue
+		if strings.HasPrefix(recv, "*") {
+			recv, fc.recvKind = recv[1:], recvPointer
+		}
+		fc.funcName = ref[end+2:]
+
+		var rest string
+		if strings.HasPrefix(recv, `"`) {
+			var ok bool
+			fc.pkg, rest, ok = parseQuotedPkgPath(recv)
+			if !ok {
+				return funcCall{}, false
+			}
+		} else if strings.HasPrefix(recv, analyzedPkg) {
+			fc.pkg, rest = analyzedPkg, recv[len(analyzedPkg):]
+		} else {
+			i := strings.LastIndex(recv, ".")
+			if i < 0 {
+				return funcCall{}, false
+			}
+
+			fc.pkg, rest = recv[:i], recv[i+1:]
+		}
+
+		fc.receiver = rest
+
+	case strings.HasPrefix(ref, `"`):
 		var (
-			receiver string
-			funcName string
+			rest string
+			ok   bool
 		)
-		fpi = strings.Index(fcv, ".")
-		switch {
-		case fpi == 0:
-			return nil, fmt.Errorf(
-				"Invalid function call reference, format is '<pkg path>.[<<type name>>.]<<func name>>'. Got: %q (from: %q)",
-				val, funcCallsFlagVal,
-			)
+		fc.pkg, rest, ok = parseQuotedPkgPath(ref)
+		if !ok {
+			return funcCall{}, false
+		}
 
-		case fpi > 0:
-			if fpi == len(fcv)-1 {
-				return nil, fmt.Errorf(
-					"Invalid function call reference, format is '<pkg path>.[<<type name>>.]<<func name>>'. Got: %q (from: %q)",
-					val, funcCallsFlagVal,
-				)
-			}
+		fc.receiver, fc.funcName, ok = strings.Cut(rest, ".")
+		if !ok {
+			fc.receiver, fc.funcName = "", rest
+		}
+
+	case strings.HasPrefix(ref, analyzedPkg):
+		fc.pkg = analyzedPkg
 
-			receiver = fcv[:fpi]
-			funcName = fcv[fpi+1:]
+		var ok bool
+		fc.receiver, fc.funcName, ok = strings.Cut(ref[len(analyzedPkg):], ".")
+		if !ok {
+			fc.receiver, fc.funcName = "", ref[len(analyzedPkg):]
+		}
 
-		default:
-			funcName = fcv
+	default:
+		slash := strings.LastIndex(ref, "/")
+		dot := strings.Index(ref[slash+1:], ".")
+		if dot < 0 {
+			return funcCall{}, false
 		}
 
-		funcCalls[i] = funcCall{
-			pkg:      pkg,
-			receiver: receiver,
-			funcName: funcName,
+		fc.pkg = ref[:slash+1+dot]
+		rest := ref[slash+1+dot+1:]
+
+		var ok bool
+		fc.receiver, fc.funcName, ok = strings.Cut(rest, ".")
+		if !ok {
+			fc.receiver, fc.funcName = "", rest
 		}
 	}
 
-	return funcCalls, nil
+	if fc.pkg == "" || strings.HasSuffix(fc.pkg, "/") || !token.IsIdentifier(fc.funcName) ||
+		(fc.receiver != "" && !token.IsIdentifier(fc.receiver)) {
+		return funcCall{}, false
+	}
+
+	// In the parenthesized form the receiver is mandatory.
+	if strings.HasPrefix(ref, "(") && fc.receiver == "" {
+		return funcCall{}, false
+	}
+
+	return fc, true
+}
+
+// parseQuotedPkgPath parses the double quoted package path which starts ref
+// and which must be followed by a dot. It returns the package path and the
+// rest of ref after the dot, or false if ref isn't well formed.
+func parseQuotedPkgPath(ref string) (string, string, bool) {
+	end := strings.Index(ref[1:], `"`)
+	if end < 0 {
+		return "", "", false
+	}
+	end++
+
+	pkg, err := strconv.Unquote(ref[:end+1])
+	if err != nil || !strings.HasPrefix(ref[end+1:], ".") {
+		return "", "", false
+	}
+
+	return pkg, ref[end+2:], true
+}
+
+// findOptions tune which of the functions that match are reported.
+type findOptions struct {
+	// isSuppressed reports the functions which are suppressed, they are
+	// classified apart. nil means that there isn't any suppressed function.
+	isSuppressed suppressFunc
+	// keepFunc reports the functions which must be reported, the rest are
+	// discarded. nil means all the functions.
+	keepFunc funcFilter
+	// keepFile reports the files which are analyzed, the rest are skipped.
+	// nil means all the files.
+	keepFile fileFilter
+	// workers is the maximum number of packages indexed concurrently. Zero or
+	// a negative value means runtime.GOMAXPROCS(0).
+	workers int
+	// backend is the backend which indexes the packages. Empty means
+	// backendAST.
+	backend string
+	// indirect makes the calls through function values to match the
+	// funcCalls which they may call too.
+	indirect bool
+	// calls makes the functions which call the funcCalls through other
+	// functions of its indexes to match too. nil means only the direct calls.
+	calls *callGraph
+	// promoted makes the calls to the methods promoted through embedded
+	// fields to also match the funcCalls of the type which embeds them.
+	promoted bool
+	// refs makes the references to the funcCalls which aren't calls, e.g. the
+	// method values or the functions passed as arguments, to match too. They
+	// aren't followed through opts.calls.
+	refs bool
 }
 
-func find(pkgsPatterns []string, funcCalls []funcCall) ([]funcsByFile, error) {
+// funcFilter reports if the function fn, declared in the file fi, must be
+// kept.
+type funcFilter func(fi *fileIndex, fn *funcIndex) bool
+
+// loadPackages loads the packages which match pkgsPatterns with their syntax
+// and type information. The patterns are relative to dir, the current
+// directory when it's empty.
+func loadPackages(dir string, pkgsPatterns []string) ([]*packages.Package, error) {
 	pkgs, err := packages.Load(&packages.Config{
+		Dir: dir,
 		Mode: packages.NeedCompiledGoFiles | packages.NeedSyntax | packages.NeedName |
-			packages.NeedTypes | packages.NeedTypesInfo,
+			packages.NeedTypes | packages.NeedTypesInfo | packages.NeedImports | packages.NeedDeps |
+			packages.NeedModule | packages.NeedFiles,
 	}, pkgsPatterns...)
 	if err != nil {
 		return nil, fmt.Errorf("error while loading packages: [%s]. %s",
@@ -171,244 +773,327 @@ func find(pkgsPatterns []string, funcCalls []funcCall) ([]funcsByFile, error) {
 		)
 	}
 
-	var funcsFiles []funcsByFile
-	for _, p := range pkgs {
-		ff, err := findFuncsNamesWhichCallFuncsSet(p, funcCalls)
-		if err != nil {
-			return nil, err
-		}
+	return pkgs, nil
+}
 
-		funcsFiles = append(funcsFiles, ff...)
+// findRule finds the functions of the idxs, which r applies to, that match r.
+// The functions which sups suppress for r are classified apart. The
+// opts.isSuppressed, opts.promoted, opts.refs and opts.indirect values are
+// ignored.
+func findRule(idxs []*pkgIndex, r rule, sups *suppressions, opts findOptions) []funcsByFile {
+	var ridxs []*pkgIndex
+	for _, idx := range idxs {
+		if r.appliesTo(idx.PkgPath) {
+			ridxs = append(ridxs, idx)
+		}
 	}
 
-	return funcsFiles, nil
-}
+	opts.isSuppressed = sups.suppressFunc(r.name)
+	opts.promoted = r.promoted
+	opts.refs = r.refs
+	opts.indirect = r.indirect
 
-// findFuncNamesWithCallsFuncsSet find the functions and methods declared in pkg
-// which call all the funcCalls and return their name classified by Go source
-// filepath.
-//
-// It returns an error if pkg doesn't contain the same number of compiled Go
-// files than the files found in Syntax.
-func findFuncsNamesWhichCallFuncsSet(pkg *packages.Package, funcCalls []funcCall) ([]funcsByFile, error) {
-	if len(pkg.Syntax) != len(pkg.CompiledGoFiles) {
-		return nil, fmt.Errorf(
-			"Package with compiled Go files is reqired. Syntax files (%d) != Go files (%d)",
-			len(pkg.Syntax), len(pkg.CompiledGoFiles),
-		)
+	var funcsFiles []funcsByFile
+	for _, funcCalls := range createSubsets(r.funcCalls, r.subsetsOf) {
+		funcsFiles = mergeFuncsByFiles(funcsFiles, findInIndexes(ridxs, funcCalls, opts))
 	}
 
-	var funcsFiles []funcsByFile
-	for i, f := range pkg.Syntax {
+	sortFuncsByFiles(funcsFiles)
+	return funcsFiles
+}
 
-		var funcNames []string
-		for _, fc := range funcCalls {
-			// func call must belong to pkg or import it otherwise it cannot call fc
-			if pkg.PkgPath != fc.pkg && !astutil.UsesImport(f, fc.pkg) {
-				funcNames = []string{}
-				break
-			}
+// findInIndexes finds the functions of the idxs which call all the funcCalls,
+// according to opts. The files are returned in the same order than idxs.
+func findInIndexes(idxs []*pkgIndex, funcCalls []funcCall, opts findOptions) []funcsByFile {
+	var funcsFiles []funcsByFile
+	for _, idx := range idxs {
+		funcsFiles = append(funcsFiles, findFuncsNamesWhichCallFuncsSet(idx, funcCalls, opts)...)
+	}
 
-			if pkg.PkgPath == fc.pkg {
-				// this func call belongs to this package so remove the pkg selector
-				fc.pkg = ""
-			}
+	return funcsFiles
+}
 
-			// TODO: could be more optimal when visiting a func defined in f, check
-			// if has calls to all funcCalls
-			fnames, err := funcsNamesWithCallFunc(f, fc, pkg.TypesInfo, pkg.Fset)
-			if err != nil {
-				fname := filepath.Join(pkg.PkgPath, filepath.Base(pkg.CompiledGoFiles[i]))
-				return nil, fmt.Errorf("%v. Source file: %s", err, fname)
-			}
+// matchFunc reports if fn, declared in idx, calls fc directly, through a
+// function value, with opts.indirect, or references it, with opts.refs. With
+// opts.promoted, the calls to the methods promoted to the type of fc match too.
+// It also returns the positions of the calls and references which match. The
+// fc.pkg must be resolved, i.e. it cannot be analyzedPkg.
+func matchFunc(
+	idx *pkgIndex, fn *funcIndex, fc funcCall, opts findOptions,
+) (called bool, calledIndirect bool, referenced bool, pos []token.Position) {
+	matches := func(c callee) bool {
+		return c.matches(fc, idx.PkgPath) || (opts.promoted && c.matchesPromoted(fc))
+	}
 
-			// File doesn't have any function which calls fc
-			if fnames == nil {
-				funcNames = []string{}
-				break
-			}
+	for _, c := range fn.Callees {
+		if c.Indirect && !opts.indirect {
+			continue
+		}
 
-			if funcNames == nil {
-				funcNames = fnames
+		if matches(c) {
+			if c.Indirect {
+				calledIndirect = true
 			} else {
-				funcNames = intersect(funcNames, fnames)
+				called = true
 			}
+			pos = append(pos, c.Pos)
 		}
+	}
 
-		if len(funcNames) > 0 {
-			fname := filepath.Join(pkg.PkgPath, filepath.Base(pkg.CompiledGoFiles[i]))
-			funcsFiles = append(funcsFiles, funcsByFile{
-				Filename:  fname,
-				FuncNames: funcNames,
-			})
+	if opts.refs {
+		for _, c := range fn.Refs {
+			if matches(c) {
+				referenced = true
+				pos = append(pos, c.Pos)
+			}
 		}
 	}
 
-	return funcsFiles, nil
+	return called, calledIndirect, referenced, pos
 }
 
-// funcsNamesWithCallFunc walcks the file for finding functions which call fnCall.
+// findFuncNamesWithCallsFuncsSet find the functions and methods of the index
+// of a package which call all the funcCalls and return their name classified
+// by Go source filepath.
 //
-// fset is only used for debugging purpose.
-func funcsNamesWithCallFunc(file *ast.File, fnCall funcCall, typesInfo *types.Info, fset *token.FileSet) ([]string, error) {
-	var funcNames []string
-	for _, d := range file.Decls {
-		fdecl, ok := d.(*ast.FuncDecl)
-		if !ok {
+// The functions which opts.isSuppressed reports are returned in the
+// SuppressedFuncNames field instead of FuncNames and the ones which
+// opts.keepFunc doesn't keep are discarded. The functions which may only call
+// some of the funcCalls through a function value are listed in the
+// IndirectFuncNames field too. With opts.refs, the functions which reference,
+// without calling, some of the funcCalls also match and they are listed in the
+// RefFuncNames field too.
+func findFuncsNamesWhichCallFuncsSet(idx *pkgIndex, funcCalls []funcCall, opts findOptions) []funcsByFile {
+	var funcsFiles []funcsByFile
+	for i := range idx.Files {
+		fi := &idx.Files[i]
+		if opts.keepFile != nil && !opts.keepFile(fi) {
 			continue
 		}
 
-		ok, err := hasFuncBodyFuncCall(fdecl.Body, fnCall, file.Imports, typesInfo, fset)
-		if err != nil {
-			return nil, err
-		}
-
-		if ok {
-			funcNames = append(funcNames, functionIdentifier(fdecl))
-		}
-	}
+		var (
+			// funcNames are the functions which call all the funcCalls,
+			// callNames the ones which call them directly or through a
+			// function value and matchNames the ones which call or, with
+			// opts.refs, reference them.
+			funcNames  []string
+			callNames  []string
+			matchNames []string
+			decls      = map[string]*funcIndex{}
+			callsPos   = map[string][]token.Position{}
+		)
+		for k, fc := range funcCalls {
+			var fnames, cnames, mnames []string
+			if opts.calls != nil {
+				reached := opts.calls.reaching(fc)
+				for j := range fi.Funcs {
+					fn := &fi.Funcs[j]
+					if pos, ok := reached[fn]; ok {
+						fnames = append(fnames, fn.ID)
+						decls[fn.ID] = fn
+						callsPos[fn.ID] = append(callsPos[fn.ID], pos...)
+					}
+				}
 
-	return funcNames, nil
-}
+				cnames, mnames = fnames, fnames
+			} else {
+				if fc.pkg == analyzedPkg {
+					fc.pkg = idx.PkgPath
+				}
 
-// hasFuncBodyFuncCall return true if fnCall is found in function body.	imports
-// are the packages imported by the file where fnCall is defined and typesInfo
-// holds the type information of the package where fnCall is defined.
-//
-// fset is used only for debugging purpose.
-//
-// fnCall.pkg must be set to empty string if the function is defined in the
-// same package that the function to inspect.
-func hasFuncBodyFuncCall(
-	body *ast.BlockStmt, fnCall funcCall, imports []*ast.ImportSpec, typesInfo *types.Info, fset *token.FileSet,
-) (bool, error) {
-	var (
-		found    bool
-		errToRet error
-	)
-	ast.Inspect(body, func(n ast.Node) bool {
-		if n == nil || found || errToRet != nil {
-			return false
-		}
+				for j := range fi.Funcs {
+					fn := &fi.Funcs[j]
+					called, calledIndirect, referenced, pos := matchFunc(idx, fn, fc, opts)
+					callsPos[fn.ID] = append(callsPos[fn.ID], pos...)
+					if called {
+						fnames = append(fnames, fn.ID)
+					}
 
-		callExpr, ok := n.(*ast.CallExpr)
-		if !ok {
-			return true
-		}
+					if called || calledIndirect {
+						cnames = append(cnames, fn.ID)
+					}
 
-		// it's a function defined in the same package
-		if ident, ok := callExpr.Fun.(*ast.Ident); ok {
-			if fnCall.pkg == "" && fnCall.receiver == "" && fnCall.funcName == ident.Name {
-				found = true
+					if called || calledIndirect || referenced {
+						mnames = append(mnames, fn.ID)
+						decls[fn.ID] = fn
+					}
+				}
 			}
 
-			return false
-		}
-
-		if _, ok := callExpr.Fun.(*ast.CallExpr); ok {
-			// TODO: Implement this case, it's happening when there is a defer call
-			// of a method
-			return true
-		}
+			// File doesn't have any function which calls fc
+			if mnames == nil {
+				matchNames = nil
+				break
+			}
 
-		if _, ok := callExpr.Fun.(*ast.ArrayType); ok {
-			// TODO: Implement this case
-			return true
+			if k == 0 {
+				funcNames, callNames, matchNames = fnames, cnames, mnames
+			} else {
+				funcNames = intersect(funcNames, fnames)
+				callNames = intersect(callNames, cnames)
+				matchNames = intersect(matchNames, mnames)
+			}
 		}
 
-		if _, ok := callExpr.Fun.(*ast.FuncLit); ok {
-			// TODO: Implement this case,it's happening when there is a defer call
-			// of an inline declared function
-			//ast.Print(fset, n)
-			return true
-		}
+		if len(matchNames) > 0 {
+			// the functions which only match because of the references or the
+			// calls through function values are reported apart
+			var (
+				refNames      = difference(matchNames, callNames)
+				indirectNames = difference(callNames, funcNames)
+			)
 
-		sel := callExpr.Fun.(*ast.SelectorExpr)
+			funcNames = matchNames
+			var suppressed []string
+			if opts.isSuppressed != nil {
+				var notSuppressed []string
+				for _, fn := range funcNames {
+					if opts.isSuppressed(decls[fn], callsPos[fn]) {
+						suppressed = append(suppressed, fn)
+					} else {
+						notSuppressed = append(notSuppressed, fn)
+					}
+				}
 
-		// receiver is a field of a struct type
-		if selx, ok := sel.X.(*ast.SelectorExpr); ok {
-			typ := typesInfo.TypeOf(selx.X)
-			if ptyp, ok := typ.(*types.Pointer); ok {
-				typ = ptyp.Elem()
+				funcNames = notSuppressed
 			}
 
-			if _, ok := typ.Underlying().(*types.Basic); ok {
-				// TODO: Implement this case, it's happening when the selector is a
-				// package name which I don't understand because in my tests it was
-				//sel.X was an *ast.Ident
-				return true
-			}
+			// Filtering after checking the suppressions keeps the suppressions of
+			// the discarded functions as used.
+			if opts.keepFunc != nil {
+				keep := func(fnames []string) []string {
+					var kept []string
+					for _, fn := range fnames {
+						if opts.keepFunc(fi, decls[fn]) {
+							kept = append(kept, fn)
+						}
+					}
 
-			var typeRef string
-			structType := typ.Underlying().(*types.Struct)
-			for i := 0; i < structType.NumFields(); i++ {
-				field := structType.Field(i)
-				if field.Name() == selx.Sel.Name {
-					typeRef = field.Type().String()
-					break
+					return kept
 				}
-			}
 
-			typeRef = removeStartingStar(typeRef)
-			pkg, typName, err := splitPackageAndType(typeRef)
-			if err != nil {
-				if errToRet != nil {
-					errToRet = err
+				funcNames = keep(funcNames)
+				suppressed = keep(suppressed)
+				refNames = keep(refNames)
+				indirectNames = keep(indirectNames)
+				if len(funcNames) == 0 && len(suppressed) == 0 {
+					continue
 				}
-
-				return true
 			}
 
-			if fnCall.pkg == pkg && fnCall.receiver == typName &&
-				fnCall.funcName == sel.Sel.Name {
-				found = true
-				return false
+			funcPos := make(map[string]funcPos, len(funcNames)+len(suppressed))
+			for _, fnames := range [][]string{funcNames, suppressed} {
+				for _, fn := range fnames {
+					funcPos[fn] = decls[fn].Pos
+				}
 			}
 
-			return true
+			funcsFiles = append(funcsFiles, funcsByFile{
+				PkgPath:             idx.PkgPath,
+				Module:              idx.Module,
+				Filename:            fi.Filename,
+				ModuleFilename:      fi.ModuleFilename,
+				Generated:           fi.Generated,
+				FuncNames:           funcNames,
+				SuppressedFuncNames: suppressed,
+				RefFuncNames:        refNames,
+				IndirectFuncNames:   indirectNames,
+				FuncPos:             funcPos,
+			})
 		}
+	}
 
-		// receiver is a package or a var
-		if ident, ok := sel.X.(*ast.Ident); ok {
-			// ident represents local package name
-			if ident.Obj == nil {
-				for _, imp := range imports {
-					if fnCall.pkg == strings.Trim(imp.Path.Value, `"`) &&
-						fnCall.funcName == sel.Sel.Name {
-						found = true
-						return false
-					}
-				}
+	return funcsFiles
+}
 
-				return true
-			}
+// sourceFile is the location on disk of a Go source file of a package.
+type sourceFile struct {
+	// Filename is the absolute path of the file. For the files generated by
+	// cgo, it's the path of the original file.
+	Filename string `json:"filename"`
+	// ModuleFilename is the path of the file relative to the module root
+	// directory. It's empty if the package doesn't belong to a module or the
+	// file is outside of the module directory.
+	ModuleFilename string `json:"module_filename,omitempty"`
+	// Cgo indicates that the file is generated by cgo, so its positions are
+	// only meaningful when they are adjusted by its //line directives.
+	Cgo bool `json:"cgo,omitempty"`
+}
 
-			typeRef := typesInfo.ObjectOf(ident).Type().String()
-			typeRef = removeStartingStar(typeRef)
-			pkg, typ, err := splitPackageAndType(typeRef)
-			if err != nil {
-				if errToRet != nil {
-					errToRet = err
-				}
+// newSourceFile returns the source file of the syntax file, which is compiled
+// from compiledFilename, of pkg.
+func newSourceFile(pkg *packages.Package, file *ast.File, compiledFilename string) sourceFile {
+	sf := sourceFile{Filename: compiledFilename}
 
+	isGoFile := func(filename string) bool {
+		for _, gf := range pkg.GoFiles {
+			if gf == filename {
 				return true
 			}
+		}
 
-			if fnCall.pkg == pkg && fnCall.receiver == typ &&
-				fnCall.funcName == sel.Sel.Name {
-				found = true
-				return false
-			}
+		return false
+	}
 
-			return true
+	// The files generated by cgo are stored in the build cache and they have
+	// //line directives which refer to the original file.
+	if !isGoFile(compiledFilename) {
+		orig := pkg.Fset.PositionFor(file.Package, true).Filename
+		if orig != compiledFilename && isGoFile(orig) {
+			sf.Filename = orig
+			sf.Cgo = true
+		}
+	}
+
+	if pkg.Module != nil && pkg.Module.Dir != "" {
+		rel, err := filepath.Rel(pkg.Module.Dir, sf.Filename)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			sf.ModuleFilename = filepath.ToSlash(rel)
 		}
+	}
+
+	return sf
+}
+
+// funcPos is the position of a function declaration.
+type funcPos struct {
+	// Line and Column are the position in the file on disk.
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	// Adjusted is the position according to the //line directives. It's the
+	// zero value when there isn't any directive which applies.
+	Adjusted token.Position `json:"adjusted"`
+}
+
+// funcPos returns the position of fdecl, which is declared in sf.
+func (sf sourceFile) funcPos(fset *token.FileSet, fdecl *ast.FuncDecl) funcPos {
+	adjusted := fset.PositionFor(fdecl.Pos(), true)
+	if sf.Cgo {
+		return funcPos{Line: adjusted.Line, Column: adjusted.Column}
+	}
+
+	pos := fset.PositionFor(fdecl.Pos(), false)
+	fp := funcPos{Line: pos.Line, Column: pos.Column}
+	if adjusted != pos {
+		fp.Adjusted = adjusted
+	}
 
-		return true
-	})
+	return fp
+}
+
+// funcLines returns the first and the last lines of fdecl, including its
+// documentation, in the file on disk. fdecl is declared in sf.
+func (sf sourceFile) funcLines(fset *token.FileSet, fdecl *ast.FuncDecl) (int, int) {
+	start := fdecl.Pos()
+	if fdecl.Doc != nil {
+		start = fdecl.Doc.Pos()
+	}
 
-	return found, errToRet
+	return fset.PositionFor(start, sf.Cgo).Line, fset.PositionFor(fdecl.End(), sf.Cgo).Line
 }
 
+// functionIdentifier returns the identifier of fdecl inside of its package,
+// e.g. "Func", "Type.Method", "*Type.Method" or "*Type[K, V].Method".
 func functionIdentifier(fdecl *ast.FuncDecl) string {
 	id := ""
 	if fdecl.Recv != nil {
@@ -418,12 +1103,63 @@ func functionIdentifier(fdecl *ast.FuncDecl) string {
 			t = st.X
 		}
 
-		id = fmt.Sprintf("%s%s.", id, t.(*ast.Ident).Name)
+		var typeParams []ast.Expr
+		switch it := t.(type) {
+		case *ast.IndexExpr:
+			t = it.X
+			typeParams = []ast.Expr{it.Index}
+		case *ast.IndexListExpr:
+			t = it.X
+			typeParams = it.Indices
+		}
+
+		id = fmt.Sprintf("%s%s", id, t.(*ast.Ident).Name)
+		if len(typeParams) > 0 {
+			names := make([]string, len(typeParams))
+			for i, tp := range typeParams {
+				names[i] = tp.(*ast.Ident).Name
+			}
+
+			id = fmt.Sprintf("%s[%s]", id, strings.Join(names, ", "))
+		}
+
+		id += "."
 	}
 
 	return fmt.Sprintf("%s%s", id, fdecl.Name.Name)
 }
 
+// qualifiedFuncName returns the package qualified name of the function with
+// the identifier funcID, as returned by functionIdentifier, declared in the
+// package pkgPath. The format is the same than types.Func.FullName, e.g.
+// "example.com/pkg.Func", "(example.com/pkg.Type).Method" or
+// "(*example.com/pkg.Type).Method".
+func qualifiedFuncName(pkgPath string, funcID string) string {
+	i := strings.LastIndex(funcID, ".")
+	if i < 0 {
+		return fmt.Sprintf("%s.%s", pkgPath, funcID)
+	}
+
+	recv, name := funcID[:i], funcID[i+1:]
+	if strings.HasPrefix(recv, "*") {
+		return fmt.Sprintf("(*%s.%s).%s", pkgPath, recv[1:], name)
+	}
+
+	return fmt.Sprintf("(%s.%s).%s", pkgPath, recv, name)
+}
+
+// difference returns the elements of a which aren't in b.
+func difference(a []string, b []string) []string {
+	var diff []string
+	for _, s := range a {
+		if !containsString(b, s) {
+			diff = append(diff, s)
+		}
+	}
+
+	return diff
+}
+
 func intersect(a []string, b []string) []string {
 	sort.Strings(a)
 	sort.Strings(b)
@@ -460,43 +1196,6 @@ func intersect(a []string, b []string) []string {
 	return intersection
 }
 
-// removeStaringStar removes "*"  from the beginning of val, otherwise returns
-// val.
-func removeStartingStar(val string) string {
-	if len(val) == 0 {
-		return val
-	}
-
-	if val[0] == '*' {
-		return val[1:]
-	}
-
-	return val
-}
-
-// splitPackateAndType return the package and type parts of the pkgPathType
-// value.
-//
-// pkgPathType cannot be empty and must be of appropriated format, e.g.
-// net/http/cookiejar.Jar. The format isn't thoroughly checked, so only a some
-// invalid formatting is detected.
-func splitPackageAndType(pkgPathType string) (pkgPath, typ string, _ error) {
-	if len(pkgPathType) == 0 {
-		return "", "", fmt.Errorf(
-			"Invalid 'package_path.type' format. Got %s", pkgPathType,
-		)
-	}
-
-	i := strings.LastIndex(pkgPathType, ".")
-	if i <= 0 {
-		return "", "", fmt.Errorf(
-			"Invalid 'package_path.type' format. Got %s", pkgPathType,
-		)
-	}
-
-	return pkgPathType[:i], pkgPathType[i+1:], nil
-}
-
 // createSubsets creates all the possible combinations of function calls sets of
 // numElems elements. If numElems is 0 or greater or equal than fnCalls length
 // only one subset equal to fnCalls is returned.
@@ -545,54 +1244,143 @@ func createSubsets(fnCalls []funcCall, numElems uint) [][]funcCall {
 }
 
 // mergeFuncByFiles merge a and b and remove any duplication.
-// The list of functions of the returned funcsByFile is lexicographically
+// The files are returned in the order which they first appear in a and b and
+// the list of functions of the returned funcsByFile is lexicographically
 // sorted.
 func mergeFuncsByFiles(a []funcsByFile, b []funcsByFile) []funcsByFile {
-	fbfMap := make(map[string]funcsByFile)
-	for _, fbf := range a {
-		if fbfm, ok := fbfMap[fbf.Filename]; ok {
-			fbfm.FuncNames = append(fbfm.FuncNames, fbf.FuncNames...)
-			fbfMap[fbf.Filename] = fbfm
-			continue
-		}
+	var (
+		fbfMap    = make(map[string]funcsByFile)
+		filenames []string
+		// called are the functions of each file which match without only
+		// referencing some of the functions in any of a or b and direct the
+		// ones which match without only referencing or calling them through a
+		// function value.
+		called = make(map[string]map[string]bool)
+		direct = make(map[string]map[string]bool)
+	)
+	for _, fbfs := range [][]funcsByFile{a, b} {
+		for _, fbf := range fbfs {
+			if direct[fbf.Filename] == nil {
+				called[fbf.Filename] = map[string]bool{}
+				direct[fbf.Filename] = map[string]bool{}
+			}
 
-		fbfMap[fbf.Filename] = fbf
-	}
+			for _, fnames := range [][]string{fbf.FuncNames, fbf.SuppressedFuncNames} {
+				for _, fn := range fnames {
+					if containsString(fbf.RefFuncNames, fn) {
+						continue
+					}
 
-	for _, fbf := range b {
-		if fbfm, ok := fbfMap[fbf.Filename]; ok {
-			fbfm.FuncNames = append(fbfm.FuncNames, fbf.FuncNames...)
-			fbfMap[fbf.Filename] = fbfm
-			continue
-		}
+					called[fbf.Filename][fn] = true
+					if !containsString(fbf.IndirectFuncNames, fn) {
+						direct[fbf.Filename][fn] = true
+					}
+				}
+			}
 
-		fbfMap[fbf.Filename] = fbf
+			if fbfm, ok := fbfMap[fbf.Filename]; ok {
+				fbfm.FuncNames = append(fbfm.FuncNames, fbf.FuncNames...)
+				fbfm.SuppressedFuncNames = append(fbfm.SuppressedFuncNames, fbf.SuppressedFuncNames...)
+				fbfm.RefFuncNames = append(fbfm.RefFuncNames, fbf.RefFuncNames...)
+				fbfm.IndirectFuncNames = append(fbfm.IndirectFuncNames, fbf.IndirectFuncNames...)
+				fbfm.FuncPos = mergeFuncPos(fbfm.FuncPos, fbf.FuncPos)
+				fbfMap[fbf.Filename] = fbfm
+				continue
+			}
+
+			fbfMap[fbf.Filename] = fbf
+			filenames = append(filenames, fbf.Filename)
+		}
 	}
 
 	merged := make([]funcsByFile, 0, len(fbfMap))
-	for _, fbf := range fbfMap {
-		var idxToRemove []int
-		sort.Slice(fbf.FuncNames, func(i, j int) bool {
-			if fbf.FuncNames[i] == fbf.FuncNames[j] {
-				idxToRemove = append(idxToRemove, j)
+	for _, fn := range filenames {
+		fbf := fbfMap[fn]
+		fbf.FuncNames = sortUnique(fbf.FuncNames)
+
+		// A function suppressed when matching a subset of function calls isn't
+		// suppressed if it also matches another subset without being suppressed.
+		var suppressed []string
+		for _, fn := range sortUnique(fbf.SuppressedFuncNames) {
+			i := sort.SearchStrings(fbf.FuncNames, fn)
+			if i < len(fbf.FuncNames) && fbf.FuncNames[i] == fn {
+				continue
 			}
 
-			return fbf.FuncNames[i] < fbf.FuncNames[j]
-		})
-
-		if len(idxToRemove) > 0 {
-
-			sort.Ints(idxToRemove)
-			idxDecrement := 0
-			for _, i := range idxToRemove {
-				j := i - idxDecrement
-				fbf.FuncNames = append(fbf.FuncNames[:j], fbf.FuncNames[j+1:]...)
-				idxDecrement++
+			suppressed = append(suppressed, fn)
+		}
+		fbf.SuppressedFuncNames = suppressed
+
+		// A function which only references some of the functions when matching
+		// a subset of function calls doesn't if it also matches another subset
+		// calling all of them.
+		var refs []string
+		for _, fn := range sortUnique(fbf.RefFuncNames) {
+			if !called[fbf.Filename][fn] {
+				refs = append(refs, fn)
+			}
+		}
+		fbf.RefFuncNames = refs
+
+		// The same applies to the functions which only call some of the
+		// functions through a function value.
+		var indirect []string
+		for _, fn := range sortUnique(fbf.IndirectFuncNames) {
+			if !direct[fbf.Filename][fn] {
+				indirect = append(indirect, fn)
 			}
 		}
+		fbf.IndirectFuncNames = indirect
 
 		merged = append(merged, fbf)
 	}
 
 	return merged
 }
+
+// mergeFuncPos returns a new map with the entries of a and b.
+func mergeFuncPos(a map[string]funcPos, b map[string]funcPos) map[string]funcPos {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+
+	merged := make(map[string]funcPos, len(a)+len(b))
+	for fn, fp := range a {
+		merged[fn] = fp
+	}
+
+	for fn, fp := range b {
+		merged[fn] = fp
+	}
+
+	return merged
+}
+
+// containsString returns true if vals contains s.
+func containsString(vals []string, s string) bool {
+	for _, v := range vals {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sortUnique sorts lexicographically vals and removes the duplicated values.
+// vals is modified.
+func sortUnique(vals []string) []string {
+	if len(vals) == 0 {
+		return vals
+	}
+
+	sort.Strings(vals)
+	uniq := vals[:1]
+	for _, v := range vals[1:] {
+		if v != uniq[len(uniq)-1] {
+			uniq = append(uniq, v)
+		}
+	}
+
+	return uniq
+}
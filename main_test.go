@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"io"
 	"sort"
 	"testing"
 
@@ -130,6 +132,124 @@ func TestParseFuncCalls(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "ok: quoted package paths",
+			in:   `"gopkg.in/yaml.v3".Unmarshal,"github.com/x/go.uuid".UUID.String,"strings".Compare`,
+			expected: returnVals{
+				funcCalls: []funcCall{
+					{
+						pkg:      "gopkg.in/yaml.v3",
+						funcName: "Unmarshal",
+					},
+					{
+						pkg:      "github.com/x/go.uuid",
+						receiver: "UUID",
+						funcName: "String",
+					},
+					{
+						pkg:      "strings",
+						funcName: "Compare",
+					},
+				},
+			},
+		},
+		{
+			name: "ok: parenthesized receivers",
+			in:   `(*net/http.Client).Do, (bytes.Buffer).Len,(*"gopkg.in/yaml.v3".Decoder).Decode,("github.com/x/go.uuid".UUID).String`,
+			expected: returnVals{
+				funcCalls: []funcCall{
+					{
+						pkg:      "net/http",
+						receiver: "Client",
+						funcName: "Do",
+						recvKind: recvPointer,
+					},
+					{
+						pkg:      "bytes",
+						receiver: "Buffer",
+						funcName: "Len",
+						recvKind: recvValue,
+					},
+					{
+						pkg:      "gopkg.in/yaml.v3",
+						receiver: "Decoder",
+						funcName: "Decode",
+						recvKind: recvPointer,
+					},
+					{
+						pkg:      "github.com/x/go.uuid",
+						receiver: "UUID",
+						funcName: "String",
+						recvKind: recvValue,
+					},
+				},
+			},
+		},
+		{
+			name: "ok: analyzed package",
+			in:   ".New,.Client.Do,(*.Client).Close",
+			expected: returnVals{
+				funcCalls: []funcCall{
+					{
+						pkg:      analyzedPkg,
+						funcName: "New",
+					},
+					{
+						pkg:      analyzedPkg,
+						receiver: "Client",
+						funcName: "Do",
+					},
+					{
+						pkg:      analyzedPkg,
+						receiver: "Client",
+						funcName: "Close",
+						recvKind: recvPointer,
+					},
+				},
+			},
+		},
+		{
+			name: "error: unterminated quoted package path",
+			in:   `"gopkg.in/yaml.v3.Unmarshal`,
+			expected: returnVals{
+				isError: true,
+			},
+		},
+		{
+			name: "error: quoted package path without func",
+			in:   `"gopkg.in/yaml.v3"`,
+			expected: returnVals{
+				isError: true,
+			},
+		},
+		{
+			name: "error: parenthesized receiver without package",
+			in:   "(*Client).Do",
+			expected: returnVals{
+				isError: true,
+			},
+		},
+		{
+			name: "error: parenthesized receiver without method",
+			in:   "(*net/http.Client)",
+			expected: returnVals{
+				isError: true,
+			},
+		},
+		{
+			name: "error: parenthesized function",
+			in:   `("strings").Compare`,
+			expected: returnVals{
+				isError: true,
+			},
+		},
+		{
+			name: "error: too many selectors",
+			in:   "bytes.Buffer.Len.X",
+			expected: returnVals{
+				isError: true,
+			},
+		},
 	}
 
 	for _, tc := range tcases {
@@ -198,72 +318,96 @@ func TestIntersect(t *testing.T) {
 	}
 }
 
+// findInTestPackages loads the indexes of the packages which match
+// pkgsPatterns with iopts and finds the functions which match r according to
+// opts.
+func findInTestPackages(
+	t *testing.T, pkgsPatterns []string, r rule, iopts indexOptions, opts findOptions,
+) []funcsByFile {
+	t.Helper()
+
+	idxs, _, err := loadIndexes("", pkgsPatterns, "", iopts, opts.workers)
+	require.NoError(t, err)
+	return findRule(idxs, r, nil, opts)
+}
+
 func TestFind(t *testing.T) {
-	t.Run("finds some functions", func(t *testing.T) {
-		cmdp, err := params([]string{
-			"-funcs", "path/filepath.Join,strings.Compare,bytes.Buffer.Reset,github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/testpkg.ExportedFunc,net/http/cookiejar.Jar.Cookies",
-			"github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/testpkg",
-		})
-		require.NoError(t, err)
+	for _, backend := range []string{backendAST, backendSSA} {
+		t.Run(backend+"/finds some functions", func(t *testing.T) {
+			cmdp, err := params([]string{
+				"-funcs", "path/filepath.Join,strings.Compare,bytes.Buffer.Reset,github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/testpkg.ExportedFunc,net/http/cookiejar.Jar.Cookies",
+				"github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/testpkg",
+			})
+			require.NoError(t, err)
 
-		list, err := find(cmdp.pkgsPatterns, cmdp.funcCalls)
-		require.NoError(t, err)
-		require.Len(t, list, 1)
+			list := findInTestPackages(t, cmdp.pkgsPatterns, cmdp.rules[0], indexOptions{backend: backend}, findOptions{})
+			require.Len(t, list, 1)
 
-		sort.Slice(list[0].FuncNames, func(i, j int) bool {
-			return list[0].FuncNames[i] < list[0].FuncNames[j]
-		})
+			sort.Slice(list[0].FuncNames, func(i, j int) bool {
+				return list[0].FuncNames[i] < list[0].FuncNames[j]
+			})
 
-		expectedFuncs := []string{
-			"unexportedFunc",
-			"*unexportedType.ExportedMethod",
-			"ExportedType.unexportedMethod",
-		}
-		sort.Slice(expectedFuncs, func(i, j int) bool {
-			return expectedFuncs[i] < expectedFuncs[j]
+			expectedFuncs := []string{
+				"unexportedFunc",
+				"*unexportedType.ExportedMethod",
+				"ExportedType.unexportedMethod",
+			}
+			sort.Slice(expectedFuncs, func(i, j int) bool {
+				return expectedFuncs[i] < expectedFuncs[j]
+			})
+
+			assert.Equal(t, expectedFuncs, list[0].FuncNames)
 		})
 
-		assert.Equal(t, expectedFuncs, list[0].FuncNames)
-	})
+		t.Run(backend+"/finds nothing", func(t *testing.T) {
+			cmdp, err := params([]string{
+				"-funcs", "path/filepath.Join,strings.Compare,bytes.Buffer.UnreadByte,github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/testpkg.ExportedFunc,net/http/cookiejar.Jar.Cookies",
+				"github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/testpkg",
+			})
+			require.NoError(t, err)
 
-	t.Run("finds nothing", func(t *testing.T) {
-		cmdp, err := params([]string{
-			"-funcs", "path/filepath.Join,strings.Compare,bytes.Buffer.UnreadByte,github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/testpkg.ExportedFunc,net/http/cookiejar.Jar.Cookies",
-			"github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/testpkg",
+			list := findInTestPackages(t, cmdp.pkgsPatterns, cmdp.rules[0], indexOptions{backend: backend}, findOptions{})
+			require.Empty(t, list)
 		})
-		require.NoError(t, err)
 
-		list, err := find(cmdp.pkgsPatterns, cmdp.funcCalls)
-		require.NoError(t, err)
-		require.Empty(t, list)
-	})
+		t.Run(backend+"/with one passed function call", func(t *testing.T) {
+			cmdp, err := params([]string{
+				"-funcs", "net/http/cookiejar.Jar.Cookies",
+				"github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/testpkg",
+			})
+			require.NoError(t, err)
 
-	t.Run("with one passed function call", func(t *testing.T) {
-		cmdp, err := params([]string{
-			"-funcs", "net/http/cookiejar.Jar.Cookies",
-			"github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/testpkg",
-		})
-		require.NoError(t, err)
+			list := findInTestPackages(t, cmdp.pkgsPatterns, cmdp.rules[0], indexOptions{backend: backend}, findOptions{})
+			require.Len(t, list, 1)
 
-		list, err := find(cmdp.pkgsPatterns, cmdp.funcCalls)
-		require.NoError(t, err)
-		require.Len(t, list, 1)
+			sort.Slice(list[0].FuncNames, func(i, j int) bool {
+				return list[0].FuncNames[i] < list[0].FuncNames[j]
+			})
 
-		sort.Slice(list[0].FuncNames, func(i, j int) bool {
-			return list[0].FuncNames[i] < list[0].FuncNames[j]
-		})
+			expectedFuncs := []string{
+				"unexportedFunc",
+				"*unexportedType.ExportedMethod",
+				"ExportedType.unexportedMethod",
+			}
+			sort.Slice(expectedFuncs, func(i, j int) bool {
+				return expectedFuncs[i] < expectedFuncs[j]
+			})
 
-		expectedFuncs := []string{
-			"unexportedFunc",
-			"*unexportedType.ExportedMethod",
-			"ExportedType.unexportedMethod",
-		}
-		sort.Slice(expectedFuncs, func(i, j int) bool {
-			return expectedFuncs[i] < expectedFuncs[j]
+			assert.Equal(t, expectedFuncs, list[0].FuncNames)
 		})
 
-		assert.Equal(t, expectedFuncs, list[0].FuncNames)
-	})
+		t.Run(backend+"/finds the calls of unreachable code", func(t *testing.T) {
+			cmdp, err := params([]string{
+				"-funcs", "strings.ToUpper",
+				"github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/unreachable",
+			})
+			require.NoError(t, err)
+
+			list := findInTestPackages(t, cmdp.pkgsPatterns, cmdp.rules[0], indexOptions{backend: backend}, findOptions{})
+			require.Len(t, list, 1)
+			assert.Equal(t, []string{"afterEndlessFor", "afterPanic", "afterReturn", "reachable"}, list[0].FuncNames)
+		})
+	}
 }
 
 func TestCreateSubsets(t *testing.T) {
@@ -468,6 +612,57 @@ func TestMergeFuncsByFiles(t *testing.T) {
 			},
 			expected: []funcsByFile{{Filename: "a.go", FuncNames: []string{"AFunc", "bFunc"}}},
 		},
+		{
+			name: "suppressed funcs",
+			in: inparams{
+				a: []funcsByFile{
+					{Filename: "a.go", FuncNames: []string{"AFunc"}, SuppressedFuncNames: []string{"bFunc", "cFunc"}},
+					{Filename: "c.go", SuppressedFuncNames: []string{"AFunc"}},
+				},
+				b: []funcsByFile{
+					{Filename: "a.go", FuncNames: []string{"bFunc"}, SuppressedFuncNames: []string{"AFunc", "cFunc"}},
+				},
+			},
+			expected: []funcsByFile{
+				{Filename: "a.go", FuncNames: []string{"AFunc", "bFunc"}, SuppressedFuncNames: []string{"cFunc"}},
+				{Filename: "c.go", SuppressedFuncNames: []string{"AFunc"}},
+			},
+		},
+		{
+			name: "ref funcs",
+			in: inparams{
+				a: []funcsByFile{
+					{Filename: "a.go", FuncNames: []string{"AFunc", "bFunc", "cFunc"}, RefFuncNames: []string{"bFunc", "cFunc"}},
+					{Filename: "c.go", SuppressedFuncNames: []string{"AFunc"}, RefFuncNames: []string{"AFunc"}},
+				},
+				b: []funcsByFile{
+					{Filename: "a.go", FuncNames: []string{"bFunc", "dFunc"}, RefFuncNames: []string{"dFunc"}},
+				},
+			},
+			expected: []funcsByFile{
+				{Filename: "a.go", FuncNames: []string{"AFunc", "bFunc", "cFunc", "dFunc"}, RefFuncNames: []string{"cFunc", "dFunc"}},
+				{Filename: "c.go", SuppressedFuncNames: []string{"AFunc"}, RefFuncNames: []string{"AFunc"}},
+			},
+		},
+		{
+			name: "indirect funcs",
+			in: inparams{
+				a: []funcsByFile{
+					{Filename: "a.go", FuncNames: []string{"AFunc", "bFunc", "cFunc"}, IndirectFuncNames: []string{"bFunc", "cFunc"}},
+				},
+				b: []funcsByFile{
+					{Filename: "a.go", FuncNames: []string{"bFunc", "cFunc", "dFunc"}, RefFuncNames: []string{"cFunc", "dFunc"}},
+				},
+			},
+			expected: []funcsByFile{
+				{
+					Filename:          "a.go",
+					FuncNames:         []string{"AFunc", "bFunc", "cFunc", "dFunc"},
+					RefFuncNames:      []string{"dFunc"},
+					IndirectFuncNames: []string{"cFunc"},
+				},
+			},
+		},
 	}
 
 	for _, tc := range tcases {
@@ -488,3 +683,158 @@ func TestMergeFuncsByFiles(t *testing.T) {
 		})
 	}
 }
+
+func TestMergeFuncsByFilesOrder(t *testing.T) {
+	merge := mergeFuncsByFiles(
+		[]funcsByFile{
+			{Filename: "z.go", FuncNames: []string{"ZFunc"}},
+			{Filename: "b.go", FuncNames: []string{"BFunc"}},
+		},
+		[]funcsByFile{
+			{Filename: "a.go", FuncNames: []string{"AFunc"}},
+			{Filename: "z.go", FuncNames: []string{"YFunc"}},
+		},
+	)
+
+	require.Equal(t, []funcsByFile{
+		{Filename: "z.go", FuncNames: []string{"YFunc", "ZFunc"}},
+		{Filename: "b.go", FuncNames: []string{"BFunc"}},
+		{Filename: "a.go", FuncNames: []string{"AFunc"}},
+	}, merge)
+}
+
+func TestFindWorkers(t *testing.T) {
+	pkgsPatterns := []string{
+		"./testdata/testpkg", "./testdata/suppressed", "./testdata/linedir", "./testdata/generated",
+	}
+
+	funcCalls, err := parseFuncCalls("strings.Compare")
+	require.NoError(t, err)
+	r := rule{funcCalls: funcCalls}
+
+	sequential := findInTestPackages(t, pkgsPatterns, r, indexOptions{}, findOptions{workers: 1})
+	require.NotEmpty(t, sequential)
+
+	for _, workers := range []int{0, 2, len(pkgsPatterns) + 1} {
+		concurrent := findInTestPackages(t, pkgsPatterns, r, indexOptions{}, findOptions{workers: workers})
+		assert.Equal(t, sequential, concurrent, "workers: %d", workers)
+	}
+}
+
+func TestRun(t *testing.T) {
+	const testpkg = "github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/testpkg"
+
+	tcases := []struct {
+		name     string
+		args     []string
+		expected int
+	}{
+		{
+			name:     "invalid flags",
+			args:     []string{"-unknown-flag", testpkg},
+			expected: exitCodeUsage,
+		},
+		{
+			name:     "funcs flag is missing",
+			args:     []string{testpkg},
+			expected: exitCodeUsage,
+		},
+		{
+			name:     "invalid backend",
+			args:     []string{"-backend", "cha", "-funcs", "net/http/cookiejar.Jar.Cookies", testpkg},
+			expected: exitCodeUsage,
+		},
+		{
+			name:     "matches without limits",
+			args:     []string{"-funcs", "net/http/cookiejar.Jar.Cookies", testpkg},
+			expected: exitCodeOK,
+		},
+		{
+			name:     "fail on match",
+			args:     []string{"-fail-on-match", "-funcs", "net/http/cookiejar.Jar.Cookies", testpkg},
+			expected: exitCodeMatches,
+		},
+		{
+			name:     "fail on match without matches",
+			args:     []string{"-fail-on-match", "-funcs", "bytes.Buffer.UnreadByte", testpkg},
+			expected: exitCodeOK,
+		},
+		{
+			name:     "max matches not exceeded",
+			args:     []string{"-max-matches", "3", "-funcs", "net/http/cookiejar.Jar.Cookies", testpkg},
+			expected: exitCodeOK,
+		},
+		{
+			name:     "max matches exceeded",
+			args:     []string{"-max-matches", "2", "-funcs", "net/http/cookiejar.Jar.Cookies", testpkg},
+			expected: exitCodeMatches,
+		},
+	}
+
+	for _, backend := range []string{backendAST, backendSSA} {
+		for _, tc := range tcases {
+			tc := tc
+			t.Run(backend+"/"+tc.name, func(t *testing.T) {
+				args := append([]string{"-backend", backend}, tc.args...)
+
+				var stdout, stderr bytes.Buffer
+				code := run(args, &stdout, &stderr)
+				assert.Equal(t, tc.expected, code, "stderr: %s", stderr.String())
+			})
+		}
+	}
+}
+
+func TestCheckMatches(t *testing.T) {
+	tcases := []struct {
+		name       string
+		cmdp       cmdParams
+		numMatches int
+		expected   int
+	}{
+		{
+			name:       "no limits",
+			cmdp:       cmdParams{maxMatches: -1},
+			numMatches: 10,
+			expected:   exitCodeOK,
+		},
+		{
+			name:       "fail on match without matches",
+			cmdp:       cmdParams{failOnMatch: true, maxMatches: -1},
+			numMatches: 0,
+			expected:   exitCodeOK,
+		},
+		{
+			name:       "fail on match with matches",
+			cmdp:       cmdParams{failOnMatch: true, maxMatches: -1},
+			numMatches: 1,
+			expected:   exitCodeMatches,
+		},
+		{
+			name:       "max matches equal",
+			cmdp:       cmdParams{maxMatches: 5},
+			numMatches: 5,
+			expected:   exitCodeOK,
+		},
+		{
+			name:       "max matches exceeded",
+			cmdp:       cmdParams{maxMatches: 5},
+			numMatches: 6,
+			expected:   exitCodeMatches,
+		},
+		{
+			name:       "max matches zero",
+			cmdp:       cmdParams{maxMatches: 0},
+			numMatches: 1,
+			expected:   exitCodeMatches,
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			code := checkMatches(tc.cmdp, tc.numMatches, io.Discard)
+			require.Equal(t, tc.expected, code)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// The orders which the matching functions can be reported in.
+const (
+	// sortFile sorts the functions by file and position in the file.
+	sortFile = "file"
+	// sortPackage sorts the functions by package and then as sortFile.
+	sortPackage = "package"
+	// sortFunc sorts the functions by their package qualified name and then as
+	// sortFile.
+	sortFunc = "func"
+	// sortMatches sorts the files by their number of matching functions, from
+	// the highest to the lowest, and then as sortFile.
+	sortMatches = "matches"
+)
+
+// validateSortBy returns an error if by isn't a valid order.
+func validateSortBy(by string) error {
+	switch by {
+	case sortFile, sortPackage, sortFunc, sortMatches:
+		return nil
+	default:
+		return fmt.Errorf(
+			"invalid sort %q, valid ones are: %s, %s, %s, %s", by, sortFile, sortPackage, sortFunc, sortMatches,
+		)
+	}
+}
+
+// sortFuncsByFiles sorts funcsFiles by filename. The functions of each file
+// are already sorted, hence the order of the returned files and functions
+// doesn't depend on the order which the packages were analyzed.
+func sortFuncsByFiles(funcsFiles []funcsByFile) {
+	sort.SliceStable(funcsFiles, func(i, j int) bool {
+		return funcsFiles[i].Filename < funcsFiles[j].Filename
+	})
+}
+
+// sortFuncResults sorts frs according to by. The functions which are equal
+// for by, keep their relative order, e.g. the same function matched by
+// several rules is reported in the order of the rules.
+func sortFuncResults(frs []funcResult, by string) {
+	byFile := func(a, b funcResult) bool {
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+
+		return a.Func < b.Func
+	}
+
+	var less func(a, b funcResult) bool
+	switch by {
+	case sortPackage:
+		less = func(a, b funcResult) bool {
+			if a.Package != b.Package {
+				return a.Package < b.Package
+			}
+
+			return byFile(a, b)
+		}
+	case sortFunc:
+		less = func(a, b funcResult) bool {
+			if a.FullName != b.FullName {
+				return a.FullName < b.FullName
+			}
+
+			return byFile(a, b)
+		}
+	case sortMatches:
+		matches := map[string]int{}
+		for _, fr := range frs {
+			matches[fr.Filename]++
+		}
+
+		less = func(a, b funcResult) bool {
+			if ma, mb := matches[a.Filename], matches[b.Filename]; ma != mb {
+				return ma > mb
+			}
+
+			return byFile(a, b)
+		}
+	default:
+		less = byFile
+	}
+
+	sort.SliceStable(frs, func(i, j int) bool {
+		return less(frs[i], frs[j])
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortFuncResults(t *testing.T) {
+	frs := []funcResult{
+		{Rule: "r1", Func: "b", FullName: "example.com/z.b", Package: "example.com/z", Filename: "/z/a.go", Line: 20},
+		{Rule: "r1", Func: "a", FullName: "example.com/z.a", Package: "example.com/z", Filename: "/z/a.go", Line: 10},
+		{Rule: "r1", Func: "c", FullName: "example.com/a.c", Package: "example.com/a", Filename: "/a/b.go", Line: 5},
+		{Rule: "r2", Func: "b", FullName: "example.com/z.b", Package: "example.com/z", Filename: "/z/a.go", Line: 20},
+		{Rule: "r1", Func: "d", FullName: "example.com/a.d", Package: "example.com/a", Filename: "/z/b.go", Line: 1},
+	}
+
+	tcases := []struct {
+		by       string
+		expected []string
+	}{
+		{by: sortFile, expected: []string{"c:r1", "a:r1", "b:r1", "b:r2", "d:r1"}},
+		{by: sortPackage, expected: []string{"c:r1", "d:r1", "a:r1", "b:r1", "b:r2"}},
+		{by: sortFunc, expected: []string{"c:r1", "d:r1", "a:r1", "b:r1", "b:r2"}},
+		{by: sortMatches, expected: []string{"a:r1", "b:r1", "b:r2", "c:r1", "d:r1"}},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.by, func(t *testing.T) {
+			sorted := append([]funcResult(nil), frs...)
+			sortFuncResults(sorted, tc.by)
+
+			var got []string
+			for _, fr := range sorted {
+				got = append(got, fr.Func+":"+fr.Rule)
+			}
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestSortFuncsByFiles(t *testing.T) {
+	funcsFiles := []funcsByFile{
+		{Filename: "/b.go", FuncNames: []string{"B"}},
+		{Filename: "/c.go", FuncNames: []string{"C"}},
+		{Filename: "/a.go", FuncNames: []string{"A"}},
+	}
+
+	sortFuncsByFiles(funcsFiles)
+	assert.Equal(t, []funcsByFile{
+		{Filename: "/a.go", FuncNames: []string{"A"}},
+		{Filename: "/b.go", FuncNames: []string{"B"}},
+		{Filename: "/c.go", FuncNames: []string{"C"}},
+	}, funcsFiles)
+}
+
+func TestRunSort(t *testing.T) {
+	const testpkg = "github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/testpkg"
+
+	var first string
+	for i := 0; i < 3; i++ {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-sort", sortFunc, "-funcs", "strings.Compare", testpkg}, &stdout, &stderr)
+		require.Equal(t, exitCodeOK, code, "stderr: %s", stderr.String())
+		require.NotEmpty(t, stdout.String())
+
+		if i == 0 {
+			first = stdout.String()
+			continue
+		}
+
+		assert.Equal(t, first, stdout.String())
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-sort", "random", "-funcs", "strings.Compare", testpkg}, &stdout, &stderr)
+	assert.Equal(t, exitCodeUsage, code)
+}
@@ -0,0 +1,239 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// The output formats.
+const (
+	formatText = "text"
+	formatCSV  = "csv"
+	formatJSON = "json"
+)
+
+// The modes of displaying the position of the functions in the text output.
+const (
+	// pathDisk displays the absolute path of the file on disk.
+	pathDisk = "disk"
+	// pathModule displays the path relative to the module root directory when
+	// the file belongs to a module, otherwise as pathDisk.
+	pathModule = "module"
+	// pathLine displays the position adjusted by the //line directives when
+	// there is any which applies, otherwise as pathDisk.
+	pathLine = "line"
+)
+
+// outputOptions are the options which tune how the results are written.
+type outputOptions struct {
+	// format is formatText or formatJSON.
+	format string
+	// pathMode is pathDisk, pathModule or pathLine. It's only used by
+	// formatText.
+	pathMode string
+	// sortBy is the order of the functions: sortFile, sortPackage, sortFunc or
+	// sortMatches.
+	sortBy string
+	// withSuppressed indicates to write the suppressed functions.
+	withSuppressed bool
+}
+
+// position is a position in a file.
+type position struct {
+	Filename string `json:"filename"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+// String returns the position with the format "<filename>:<line>:<column>".
+// The column is omitted when it's unknown.
+func (p position) String() string {
+	if p.Column == 0 {
+		return fmt.Sprintf("%s:%d", p.Filename, p.Line)
+	}
+
+	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+}
+
+// funcResult is a function which matches a rule.
+type funcResult struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message,omitempty"`
+	// Func is the identifier of the function inside of its package.
+	Func string `json:"func"`
+	// FullName is the package qualified name of the function with the same
+	// format than types.Func.FullName.
+	FullName string `json:"full_name"`
+	Package  string `json:"package"`
+	Module   string `json:"module,omitempty"`
+	// Filename is the absolute path of the file on disk.
+	Filename       string `json:"filename"`
+	ModuleFilename string `json:"module_filename,omitempty"`
+	Line           int    `json:"line"`
+	Column         int    `json:"column"`
+	// LinePosition is the position adjusted by the //line directives. It's nil
+	// when there isn't any directive which applies.
+	LinePosition *position `json:"line_position,omitempty"`
+	Suppressed   bool      `json:"suppressed,omitempty"`
+	// Ref indicates that the function only matches because it references,
+	// without calling, some of the functions of the rule.
+	Ref bool `json:"ref,omitempty"`
+	// Indirect indicates that the function only matches because it may call
+	// some of the functions of the rule through a function value.
+	Indirect bool `json:"indirect,omitempty"`
+	// Generated indicates that the function is in a generated file.
+	Generated bool `json:"generated,omitempty"`
+}
+
+// displayPosition returns the position of the function according to
+// pathMode.
+func (fr funcResult) displayPosition(pathMode string) string {
+	pos := position{Filename: fr.Filename, Line: fr.Line, Column: fr.Column}
+	switch pathMode {
+	case pathModule:
+		if fr.ModuleFilename != "" {
+			pos.Filename = fr.ModuleFilename
+		}
+	case pathLine:
+		if fr.LinePosition != nil {
+			pos = *fr.LinePosition
+		}
+	}
+
+	return pos.String()
+}
+
+// funcResults flattens results in a list of functions. The suppressed
+// functions are only included when withSuppressed is true.
+func funcResults(results []ruleResult, withSuppressed bool) ([]funcResult, error) {
+	var frs []funcResult
+	add := func(r rule, fbf funcsByFile, fname string, suppressed bool) error {
+		fp := fbf.FuncPos[fname]
+		fr := funcResult{
+			Rule:           r.name,
+			Severity:       r.severity,
+			Func:           fname,
+			FullName:       qualifiedFuncName(fbf.PkgPath, fname),
+			Package:        fbf.PkgPath,
+			Module:         fbf.Module,
+			Filename:       fbf.Filename,
+			ModuleFilename: fbf.ModuleFilename,
+			Line:           fp.Line,
+			Column:         fp.Column,
+			Suppressed:     suppressed,
+			Ref:            containsString(fbf.RefFuncNames, fname),
+			Indirect:       containsString(fbf.IndirectFuncNames, fname),
+			Generated:      fbf.Generated,
+		}
+		if fp.Adjusted.IsValid() {
+			fr.LinePosition = &position{
+				Filename: fp.Adjusted.Filename,
+				Line:     fp.Adjusted.Line,
+				Column:   fp.Adjusted.Column,
+			}
+		}
+
+		msg, err := r.formatMessage(fr)
+		if err != nil {
+			return err
+		}
+
+		fr.Message = msg
+		frs = append(frs, fr)
+		return nil
+	}
+
+	for _, rr := range results {
+		for _, fbf := range rr.funcsFiles {
+			for _, fname := range fbf.FuncNames {
+				if err := add(rr.rule, fbf, fname, false); err != nil {
+					return nil, err
+				}
+			}
+
+			if !withSuppressed {
+				continue
+			}
+
+			for _, fname := range fbf.SuppressedFuncNames {
+				if err := add(rr.rule, fbf, fname, true); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return frs, nil
+}
+
+// printResults writes to w the functions of results according to opts.
+func printResults(w io.Writer, opts outputOptions, results []ruleResult) error {
+	frs, err := funcResults(results, opts.withSuppressed)
+	if err != nil {
+		return err
+	}
+
+	sortFuncResults(frs, opts.sortBy)
+	if opts.format == formatJSON {
+		return printResultsJSON(w, frs)
+	}
+
+	return printResultsText(w, frs, opts.pathMode)
+}
+
+// printResultsText writes to w a line for each function of frs with the format
+// "<filename>:<line>:<column>: <function>: <rule>[<severity>]: <message>",
+// where the position is displayed according to pathMode. The message part is
+// omitted when it's empty, the lines of the functions of generated files end
+// with " (generated)", the ones of the functions which only reference some of
+// the functions of the rule with " (ref)", the ones which only call some of
+// them through a function value with " (indirect)" and the ones of the
+// suppressed functions with " (suppressed)".
+func printResultsText(w io.Writer, frs []funcResult, pathMode string) error {
+	for _, fr := range frs {
+		line := fmt.Sprintf("%s: %s: %s[%s]",
+			fr.displayPosition(pathMode), fr.Func, fr.Rule, fr.Severity,
+		)
+		if fr.Message != "" {
+			line = fmt.Sprintf("%s: %s", line, fr.Message)
+		}
+
+		if fr.Generated {
+			line += " (generated)"
+		}
+
+		if fr.Ref {
+			line += " (ref)"
+		}
+
+		if fr.Indirect {
+			line += " (indirect)"
+		}
+
+		if fr.Suppressed {
+			line += " (suppressed)"
+		}
+
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printResultsJSON writes to w frs as a JSON array.
+func printResultsJSON(w io.Writer, frs []funcResult) error {
+	if frs == nil {
+		frs = []funcResult{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(frs)
+}
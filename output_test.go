@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/types"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQualifiedFuncName(t *testing.T) {
+	tcases := []struct {
+		funcID   string
+		expected string
+	}{
+		{funcID: "Func", expected: "example.com/pkg.Func"},
+		{funcID: "Type.Method", expected: "(example.com/pkg.Type).Method"},
+		{funcID: "*Type.Method", expected: "(*example.com/pkg.Type).Method"},
+		{funcID: "*Type[K, V].Method", expected: "(*example.com/pkg.Type[K, V]).Method"},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.funcID, func(t *testing.T) {
+			assert.Equal(t, tc.expected, qualifiedFuncName("example.com/pkg", tc.funcID))
+		})
+	}
+
+	t.Run("same than types.Func.FullName", func(t *testing.T) {
+		pkgs, err := loadPackages("", []string{"github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/testpkg"})
+		require.NoError(t, err)
+		require.Len(t, pkgs, 1)
+
+		var numFuncs int
+		for _, f := range pkgs[0].Syntax {
+			for _, d := range f.Decls {
+				fdecl, ok := d.(*ast.FuncDecl)
+				if !ok {
+					continue
+				}
+
+				fn := pkgs[0].TypesInfo.Defs[fdecl.Name].(*types.Func)
+				assert.Equal(t, fn.FullName(), qualifiedFuncName(pkgs[0].PkgPath, functionIdentifier(fdecl)))
+				numFuncs++
+			}
+		}
+
+		assert.Equal(t, 9, numFuncs)
+	})
+}
+
+func TestRunJSONFormat(t *testing.T) {
+	const testpkg = "github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/testpkg"
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-format", "json", "-funcs", "bytes.NewBufferString", testpkg}, &stdout, &stderr)
+	require.Equal(t, exitCodeOK, code, "stderr: %s", stderr.String())
+
+	var frs []funcResult
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &frs))
+	require.Len(t, frs, 2)
+
+	filename, err := filepath.Abs("testdata/testpkg/impl.go")
+	require.NoError(t, err)
+	for _, fr := range frs {
+		assert.Equal(t, defaultRuleName, fr.Rule)
+		assert.Equal(t, testpkg, fr.Package)
+		assert.Equal(t, "github.com/ifraixedes/find-funcs-with-set-funcs-calls", fr.Module)
+		assert.Equal(t, filename, fr.Filename)
+		assert.Equal(t, "testdata/testpkg/impl.go", fr.ModuleFilename)
+		assert.Nil(t, fr.LinePosition)
+	}
+
+	var fullNames []string
+	for _, fr := range frs {
+		fullNames = append(fullNames, fr.FullName)
+	}
+	assert.ElementsMatch(t, []string{
+		testpkg + ".unexportedFunc",
+		"(" + testpkg + ".ExportedType).ExportedMethod",
+	}, fullNames)
+
+	t.Run("invalid path", func(t *testing.T) {
+		code := run([]string{"-path", "import", "-funcs", "path/filepath.Join", testpkg}, &stdout, &stderr)
+		require.Equal(t, exitCodeUsage, code)
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		code := run([]string{"-format", "xml", "-funcs", "path/filepath.Join", testpkg}, &stdout, &stderr)
+		require.Equal(t, exitCodeUsage, code)
+	})
+}
+
+func TestRunPathModes(t *testing.T) {
+	const linedir = "github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/linedir"
+
+	filename, err := filepath.Abs("testdata/linedir/gen.go")
+	require.NoError(t, err)
+
+	tcases := []struct {
+		pathMode string
+		expected string
+	}{
+		{pathMode: pathDisk, expected: filename + ":8:1: templated: default[warning] (generated)\n"},
+		{pathMode: pathModule, expected: "testdata/linedir/gen.go:8:1: templated: default[warning] (generated)\n"},
+		{pathMode: pathLine, expected: filepath.Join(filepath.Dir(filename), "linedir.tmpl") + ":10: templated: default[warning] (generated)\n"},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.pathMode, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run([]string{"-path", tc.pathMode, "-funcs", "strings.Compare", linedir}, &stdout, &stderr)
+			require.Equal(t, exitCodeOK, code, "stderr: %s", stderr.String())
+			assert.Equal(t, tc.expected, stdout.String())
+		})
+	}
+}
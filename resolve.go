@@ -0,0 +1,71 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// analyzedPkg is the package of the funcCalls which refer to the functions of
+// the package being analyzed, so in each package they refer to its own
+// functions, e.g. ".New" matches the calls to the New function of the same
+// package.
+const analyzedPkg = "."
+
+// resolvePkgNames returns rules with the package of each funcCall which isn't
+// the path of any package of tp replaced by the path of the package with such
+// name imported by the files of idxs, so the packages can be referred by their
+// name, e.g. "yaml.Unmarshal".
+//
+// The packages which aren't imported are kept, so they are reported as
+// unknown. It returns an error if several imported packages have the name.
+func resolvePkgNames(rules []rule, idxs []*pkgIndex, tp typesPackages) ([]rule, error) {
+	var (
+		byName = map[string][]string{}
+		seen   = map[string]bool{}
+	)
+	for _, idx := range idxs {
+		for _, fi := range idx.Files {
+			for _, imp := range fi.Imports {
+				if seen[imp] {
+					continue
+				}
+
+				seen[imp] = true
+				if pkg, ok := tp[imp]; ok {
+					byName[pkg.Name()] = append(byName[pkg.Name()], imp)
+				}
+			}
+		}
+	}
+
+	resolved := make([]rule, len(rules))
+	for i, r := range rules {
+		fcalls := make([]funcCall, len(r.funcCalls))
+		for j, fc := range r.funcCalls {
+			if _, ok := tp[fc.pkg]; !ok && fc.pkg != analyzedPkg {
+				switch paths := byName[fc.pkg]; len(paths) {
+				case 0:
+				case 1:
+					fc.pkg = paths[0]
+				default:
+					sort.Strings(paths)
+					return nil, fmt.Errorf(
+						"rule %q: ambiguous package name %q, the imported packages with such name are: %s",
+						r.name, fc.pkg, strings.Join(paths, ", "),
+					)
+				}
+			}
+
+			fcalls[j] = fc
+		}
+
+		r.funcCalls = fcalls
+		resolved[i] = r
+	}
+
+	return resolved, nil
+}
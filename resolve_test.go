@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newResolveModule creates a module in a temporary directory with two
+// packages named yaml, the package c which imports one of them and the package
+// d which imports the other. It returns the module directory.
+func newResolveModule(t *testing.T) string {
+	modDir := t.TempDir()
+	for name, content := range map[string]string{
+		"go.mod":         "module example.com/resolvetest\n\ngo 1.22\n",
+		"yaml/yaml.go":   "package yaml\n\nfunc Unmarshal() {}\n",
+		"yaml3/yaml.go":  "package yaml\n\nfunc Unmarshal() {}\n",
+		"c/c.go":         "package c\n\nimport \"example.com/resolvetest/yaml\"\n\nfunc New() {}\n\nfunc F() { yaml.Unmarshal() }\n\nfunc G() { New() }\n",
+		"d/d.go":         "package d\n\nimport \"example.com/resolvetest/yaml3\"\n\nfunc New() {}\n\nfunc F() { yaml.Unmarshal() }\n\nfunc H() { New() }\n",
+		"e/e.go":         "package e\n\nimport \"example.com/resolvetest/c\"\n\nfunc F() { c.New() }\n",
+		"yaml3/other.go": "package yaml\n\nfunc New() {}\n",
+	} {
+		filename := filepath.Join(modDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0o755))
+		require.NoError(t, os.WriteFile(filename, []byte(content), 0o644))
+	}
+
+	return modDir
+}
+
+func TestResolvePkgNames(t *testing.T) {
+	modDir := newResolveModule(t)
+
+	resolve := func(t *testing.T, patterns []string, funcs string) ([]funcCall, error) {
+		idxs, tp, err := loadIndexes(modDir, patterns, "", indexOptions{}, 0)
+		require.NoError(t, err)
+
+		fcalls, err := parseFuncCalls(funcs)
+		require.NoError(t, err)
+
+		rules, err := resolvePkgNames([]rule{{name: defaultRuleName, funcCalls: fcalls}}, idxs, tp)
+		if err != nil {
+			return nil, err
+		}
+
+		return rules[0].funcCalls, nil
+	}
+
+	t.Run("imported name", func(t *testing.T) {
+		fcalls, err := resolve(t, []string{"./c"}, "yaml.Unmarshal,strings.Compare,(*yaml.Decoder).Decode")
+		require.NoError(t, err)
+		assert.Equal(t, []funcCall{
+			{pkg: "example.com/resolvetest/yaml", funcName: "Unmarshal"},
+			{pkg: "strings", funcName: "Compare"},
+			{pkg: "example.com/resolvetest/yaml", receiver: "Decoder", funcName: "Decode", recvKind: recvPointer},
+		}, fcalls)
+
+		fcalls, err = resolve(t, []string{"./d"}, "yaml.Unmarshal")
+		require.NoError(t, err)
+		assert.Equal(t, []funcCall{{pkg: "example.com/resolvetest/yaml3", funcName: "Unmarshal"}}, fcalls)
+	})
+
+	t.Run("ambiguous name", func(t *testing.T) {
+		_, err := resolve(t, []string{"./..."}, "yaml.Unmarshal")
+		require.Error(t, err)
+		assert.Equal(t,
+			`rule "default": ambiguous package name "yaml", the imported packages with such name are: `+
+				"example.com/resolvetest/yaml, example.com/resolvetest/yaml3",
+			err.Error(),
+		)
+	})
+
+	t.Run("path", func(t *testing.T) {
+		// The loaded packages are referred by their path, even if they aren't
+		// imported and there is an imported package with such name.
+		fcalls, err := resolve(t, []string{"./..."}, "example.com/resolvetest/yaml.Unmarshal")
+		require.NoError(t, err)
+		assert.Equal(t, []funcCall{{pkg: "example.com/resolvetest/yaml", funcName: "Unmarshal"}}, fcalls)
+	})
+
+	t.Run("not imported", func(t *testing.T) {
+		fcalls, err := resolve(t, []string{"./c"}, "json.Marshal,.New")
+		require.NoError(t, err)
+		assert.Equal(t, []funcCall{
+			{pkg: "json", funcName: "Marshal"},
+			{pkg: analyzedPkg, funcName: "New"},
+		}, fcalls)
+	})
+}
+
+func TestRunResolvePkgNames(t *testing.T) {
+	modDir := newResolveModule(t)
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(modDir))
+	defer func() { require.NoError(t, os.Chdir(wd)) }()
+
+	testCases := []struct {
+		desc   string
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{
+			desc:   "imported name",
+			args:   []string{"-funcs", "yaml.Unmarshal", "./c"},
+			stdout: "c/c.go:7:1: F: default[warning]\n",
+		},
+		{
+			desc:   "ambiguous name",
+			args:   []string{"-funcs", "yaml.Unmarshal", "./..."},
+			code:   exitCodeUsage,
+			stderr: `rule "default": ambiguous package name "yaml", the imported packages with such name are: ` + "example.com/resolvetest/yaml, example.com/resolvetest/yaml3\n",
+		},
+		{
+			desc:   "analyzed package",
+			args:   []string{"-funcs", ".New", "./..."},
+			stdout: "c/c.go:9:1: G: default[warning]\nd/d.go:9:1: H: default[warning]\n",
+		},
+		{
+			desc:   "analyzed package and imported package",
+			args:   []string{"-funcs", ".New,c.New", "-sub", "1", "./..."},
+			stdout: "c/c.go:9:1: G: default[warning]\nd/d.go:9:1: H: default[warning]\ne/e.go:5:1: F: default[warning]\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(tc.args, &stdout, &stderr)
+			assert.Equal(t, tc.code, code)
+			assert.Equal(t, tc.stdout, stdout.String())
+			assert.Equal(t, tc.stderr, stderr.String())
+		})
+	}
+}
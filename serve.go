@@ -0,0 +1,386 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// serveCmd is the name of the subcommand which serves queries through an HTTP
+// API.
+const serveCmd = "serve"
+
+// serveParams are the command line flags and arguments of the serve
+// subcommand.
+type serveParams struct {
+	packagesParams
+	addr string
+}
+
+// parseServeParams parses and maps the command line flags and arguments of
+// the serve subcommand. inParams is the list of command line arguments after
+// the subcommand name. The packages patterns are "./..." when there isn't any.
+func parseServeParams(inParams []string) (serveParams, error) {
+	fset := flag.NewFlagSet(serveCmd, flag.ContinueOnError)
+	addr := fset.String("addr", "localhost:8080", "the address where the HTTP API listens")
+	pflags := addPackagesFlags(fset)
+
+	if err := fset.Parse(inParams); err != nil {
+		return serveParams{}, err
+	}
+
+	pp, err := pflags.params()
+	if err != nil {
+		return serveParams{}, err
+	}
+
+	return serveParams{packagesParams: pp, addr: *addr}, nil
+}
+
+// runServe executes the serve subcommand with args, which are the command line
+// arguments after the subcommand name, and returns the exit code. It serves
+// the HTTP API until the process is interrupted.
+func runServe(args []string, stdout io.Writer, stderr io.Writer) int {
+	sp, err := parseServeParams(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitCodeOK
+		}
+
+		fmt.Fprintln(stderr, err)
+		return exitCodeUsage
+	}
+
+	qs, err := newQueryServer(".", sp)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitCodeError
+	}
+
+	lis, err := net.Listen("tcp", sp.addr)
+	if err != nil {
+		fmt.Fprintf(stderr, "error while listening: %v\n", err)
+		return exitCodeError
+	}
+
+	srv := &http.Server{Handler: qs.handler()}
+	go func() {
+		<-interruptChan()
+		_ = srv.Shutdown(context.Background())
+	}()
+
+	fmt.Fprintf(stdout, "listening on http://%s\n", lis.Addr())
+	if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(stderr, err)
+		return exitCodeError
+	}
+
+	return exitCodeOK
+}
+
+// queryRequest is the body of the request which creates a query.
+type queryRequest struct {
+	// Funcs are the functions to find where are all called inside of a
+	// function, with the same format than the values of the funcs flag.
+	Funcs []string `json:"funcs"`
+	// Sub is the same than the sub flag.
+	Sub uint `json:"sub"`
+}
+
+// queryResponse is a query with the functions which match it.
+type queryResponse struct {
+	ID      string       `json:"id"`
+	Funcs   []string     `json:"funcs"`
+	Sub     uint         `json:"sub"`
+	Results []funcResult `json:"results"`
+	// Warnings are the funcs which don't exist in the loaded packages.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// calleesResponse is the list of the calls of the bodies of the functions with
+// the package qualified name Func.
+type calleesResponse struct {
+	Func    string         `json:"func"`
+	Callees []calleeResult `json:"callees"`
+}
+
+// calleeResult is a call of a function body.
+type calleeResult struct {
+	Kind     string `json:"kind"`
+	Pkg      string `json:"pkg,omitempty"`
+	Receiver string `json:"receiver,omitempty"`
+	Name     string `json:"name"`
+	// Indirect indicates that the call is through a function value which may
+	// call the function.
+	Indirect bool   `json:"indirect,omitempty"`
+	Filename string `json:"filename"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+// findCallees returns the calls of the bodies of the functions of idxs whose
+// package qualified name is name. It returns false if there isn't any function
+// with such name.
+func findCallees(idxs []*pkgIndex, name string) ([]calleeResult, bool) {
+	var (
+		found   bool
+		callees = []calleeResult{}
+	)
+	for _, idx := range idxs {
+		for _, fi := range idx.Files {
+			for _, fn := range fi.Funcs {
+				if qualifiedFuncName(idx.PkgPath, fn.ID) != name {
+					continue
+				}
+
+				found = true
+				for _, c := range fn.Callees {
+					callees = append(callees, calleeResult{
+						Kind:     c.Kind,
+						Pkg:      c.Pkg,
+						Receiver: c.Receiver,
+						Name:     c.Name,
+						Indirect: c.Indirect,
+						Filename: c.Pos.Filename,
+						Line:     c.Pos.Line,
+						Column:   c.Pos.Column,
+					})
+				}
+			}
+		}
+	}
+
+	return callees, found
+}
+
+// reloadResponse is the response of reloading the packages.
+type reloadResponse struct {
+	Packages int `json:"packages"`
+}
+
+// errorResponse is the body of the responses of the failed requests.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// queryServer serves the queries of the functions which call a set of
+// functions on the packages which it loads once. The queries are stored, so
+// their results can be retrieved, according to the current packages, later.
+type queryServer struct {
+	dir string
+	sp  serveParams
+
+	mu      sync.RWMutex
+	idxs    []*pkgIndex
+	tp      typesPackages
+	queries map[string]queryRequest
+	nextID  int
+}
+
+// newQueryServer returns a server of the packages which match the patterns of
+// sp, relative to dir, after loading them.
+func newQueryServer(dir string, sp serveParams) (*queryServer, error) {
+	qs := &queryServer{dir: dir, sp: sp, queries: map[string]queryRequest{}}
+	if _, err := qs.reload(); err != nil {
+		return nil, err
+	}
+
+	return qs, nil
+}
+
+// handler returns the handler of the HTTP API:
+//
+//	POST /queries       creates a query and responds its results.
+//	GET  /queries/{id}  responds the results of a query.
+//	GET  /callees?func= responds the calls of a function.
+//	POST /reload        loads the packages again.
+func (qs *queryServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /queries", qs.handleCreateQuery)
+	mux.HandleFunc("GET /queries/{id}", qs.handleGetQuery)
+	mux.HandleFunc("GET /callees", qs.handleCallees)
+	mux.HandleFunc("POST /reload", qs.handleReload)
+	return mux
+}
+
+// reload loads and indexes the packages and returns how many they are.
+func (qs *queryServer) reload() (int, error) {
+	idxs, tp, err := loadIndexes(qs.dir, qs.sp.pkgsPatterns, "", indexOptions{}, qs.sp.workers)
+	if err != nil {
+		return 0, err
+	}
+
+	qs.mu.Lock()
+	qs.idxs, qs.tp = idxs, tp
+	qs.mu.Unlock()
+	return len(idxs), nil
+}
+
+func (qs *queryServer) handleCreateQuery(w http.ResponseWriter, r *http.Request) {
+	var qr queryRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&qr); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid query: %v", err))
+		return
+	}
+
+	rule, err := qr.rule()
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	qs.mu.Lock()
+	qs.nextID++
+	id := strconv.Itoa(qs.nextID)
+	qs.mu.Unlock()
+
+	// The query is only stored when it can be evaluated, e.g. its package
+	// names aren't ambiguous.
+	resp, err := qs.evaluate(id, qr, rule)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	qs.mu.Lock()
+	qs.queries[id] = qr
+	qs.mu.Unlock()
+
+	w.Header().Set("Location", "/queries/"+id)
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (qs *queryServer) handleGetQuery(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	qs.mu.RLock()
+	qr, ok := qs.queries[id]
+	qs.mu.RUnlock()
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("query %q not found", id))
+		return
+	}
+
+	rule, err := qr.rule()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp, err := qs.evaluate(id, qr, rule)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (qs *queryServer) handleCallees(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("func")
+	if name == "" {
+		writeJSONError(w, http.StatusBadRequest, errors.New("func query parameter is required"))
+		return
+	}
+
+	qs.mu.RLock()
+	callees, ok := findCallees(qs.idxs, name)
+	qs.mu.RUnlock()
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("function %q not found", name))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, calleesResponse{Func: name, Callees: callees})
+}
+
+func (qs *queryServer) handleReload(w http.ResponseWriter, r *http.Request) {
+	n, err := qs.reload()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, reloadResponse{Packages: n})
+}
+
+// evaluate applies the rule of the query qr, with the identifier id, to the
+// current packages.
+func (qs *queryServer) evaluate(id string, qr queryRequest, r rule) (queryResponse, error) {
+	qs.mu.RLock()
+	idxs, tp := qs.idxs, qs.tp
+	qs.mu.RUnlock()
+
+	rules, err := resolvePkgNames([]rule{r}, idxs, tp)
+	if err != nil {
+		return queryResponse{}, err
+	}
+	r = rules[0]
+
+	sups, _ := collectSuppressions(idxs, qs.sp.keepFile)
+	results := []ruleResult{{
+		rule:       r,
+		funcsFiles: findRule(idxs, r, sups, findOptions{keepFile: qs.sp.keepFile}),
+	}}
+
+	frs, err := funcResults(results, false)
+	if err != nil {
+		return queryResponse{}, err
+	}
+
+	sortFuncResults(frs, sortFile)
+	if frs == nil {
+		frs = []funcResult{}
+	}
+
+	return queryResponse{
+		ID:       id,
+		Funcs:    qr.Funcs,
+		Sub:      qr.Sub,
+		Results:  frs,
+		Warnings: tp.withUnimported(qs.dir, []rule{r}).checkFuncCalls(r.funcCalls),
+	}, nil
+}
+
+// rule returns the rule which corresponds to qr.
+func (qr queryRequest) rule() (rule, error) {
+	if len(qr.Funcs) == 0 {
+		return rule{}, errors.New("invalid query: funcs cannot be empty")
+	}
+
+	fcalls, err := parseFuncCalls(strings.Join(qr.Funcs, ","))
+	if err != nil {
+		return rule{}, fmt.Errorf("invalid query: %v", err)
+	}
+
+	return rule{
+		name:      defaultRuleName,
+		severity:  severityWarning,
+		funcCalls: fcalls,
+		subsetsOf: qr.Sub,
+	}, nil
+}
+
+// writeJSON writes v in JSON as the body of the response with status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError writes err in JSON as the body of the response with status.
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
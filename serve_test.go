@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryServer(t *testing.T) {
+	modDir, writeFile := newWatchModule(t)
+
+	sp, err := parseServeParams(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"./..."}, sp.pkgsPatterns)
+
+	qs, err := newQueryServer(modDir, sp)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(qs.handler())
+	defer srv.Close()
+
+	do := func(t *testing.T, method string, path string, body string, status int, v interface{}) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+
+		require.Equal(t, status, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		return resp
+	}
+
+	funcs := func(frs []funcResult) []string {
+		var names []string
+		for _, fr := range frs {
+			names = append(names, fr.FullName)
+		}
+
+		return names
+	}
+
+	t.Run("query", func(t *testing.T) {
+		var qr queryResponse
+		resp := do(t, http.MethodPost, "/queries", `{"funcs": ["strings.Compare"]}`, http.StatusCreated, &qr)
+		assert.Equal(t, "/queries/"+qr.ID, resp.Header.Get("Location"))
+		assert.Equal(t, []string{"strings.Compare"}, qr.Funcs)
+		assert.Equal(t, []string{"example.com/watchtest/a.F"}, funcs(qr.Results))
+
+		var got queryResponse
+		do(t, http.MethodGet, "/queries/"+qr.ID, "", http.StatusOK, &got)
+		assert.Equal(t, qr, got)
+	})
+
+	t.Run("query without matches", func(t *testing.T) {
+		var qr queryResponse
+		do(t, http.MethodPost, "/queries", `{"funcs": ["strings.Index"]}`, http.StatusCreated, &qr)
+		assert.NotNil(t, qr.Results)
+		assert.Empty(t, qr.Results)
+		assert.Empty(t, qr.Warnings)
+
+		do(t, http.MethodPost, "/queries", `{"funcs": ["strings.Compar"]}`, http.StatusCreated, &qr)
+		assert.Empty(t, qr.Results)
+		assert.Equal(t,
+			[]string{`unknown function "Compar" in package "strings", did you mean "Compare"?`}, qr.Warnings,
+		)
+	})
+
+	t.Run("invalid queries", func(t *testing.T) {
+		for _, body := range []string{`{}`, `{"funcs": ["Compare"]}`, `{"fncs": []}`, `[`} {
+			var er errorResponse
+			do(t, http.MethodPost, "/queries", body, http.StatusBadRequest, &er)
+			assert.Contains(t, er.Error, "invalid query", body)
+		}
+
+		var er errorResponse
+		do(t, http.MethodGet, "/queries/100", "", http.StatusNotFound, &er)
+		assert.Equal(t, `query "100" not found`, er.Error)
+	})
+
+	t.Run("callees", func(t *testing.T) {
+		var cr calleesResponse
+		do(t, http.MethodGet, "/callees?func="+url.QueryEscape("example.com/watchtest/a.F"), "", http.StatusOK, &cr)
+		assert.Equal(t, calleesResponse{
+			Func: "example.com/watchtest/a.F",
+			Callees: []calleeResult{{
+				Kind:     calleeImport,
+				Pkg:      "strings",
+				Name:     "Compare",
+				Filename: filepath.Join(modDir, "a", "a.go"),
+				Line:     5,
+				Column:   12,
+			}},
+		}, cr)
+
+		var er errorResponse
+		do(t, http.MethodGet, "/callees?func=example.com/watchtest/a.G", "", http.StatusNotFound, &er)
+		do(t, http.MethodGet, "/callees", "", http.StatusBadRequest, &er)
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		var qr queryResponse
+		do(t, http.MethodPost, "/queries", `{"funcs": ["strings.Compare"]}`, http.StatusCreated, &qr)
+
+		writeFile("b/b.go", "package b\n\nimport \"strings\"\n\nfunc G() { strings.Compare(\"a\", \"b\") }\n")
+
+		// the results don't change until the packages are loaded again
+		var got queryResponse
+		do(t, http.MethodGet, "/queries/"+qr.ID, "", http.StatusOK, &got)
+		assert.Equal(t, []string{"example.com/watchtest/a.F"}, funcs(got.Results))
+
+		var rr reloadResponse
+		do(t, http.MethodPost, "/reload", "", http.StatusOK, &rr)
+		assert.Equal(t, 2, rr.Packages)
+
+		do(t, http.MethodGet, "/queries/"+qr.ID, "", http.StatusOK, &got)
+		assert.Equal(t,
+			[]string{"example.com/watchtest/a.F", "example.com/watchtest/b.G"}, funcs(got.Results),
+		)
+	})
+}
+
+func TestParseServeParams(t *testing.T) {
+	sp, err := parseServeParams([]string{"-addr", ":9000", "-generated", "skip", "./a"})
+	require.NoError(t, err)
+	assert.Equal(t, ":9000", sp.addr)
+	assert.Equal(t, []string{"./a"}, sp.pkgsPatterns)
+	assert.NotNil(t, sp.keepFile)
+
+	_, err = parseServeParams([]string{"-generated", "all"})
+	require.Error(t, err)
+
+	_, err = parseServeParams([]string{"-j", "-1"})
+	require.Error(t, err)
+}
@@ -0,0 +1,143 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// The backends which resolve the calls of the function bodies.
+const (
+	// backendAST resolves the calls from the syntax tree and the type
+	// information.
+	backendAST = "ast"
+	// backendSSA resolves the calls from the SSA form, where each call has a
+	// static callee or it's an interface method call.
+	backendSSA = "ssa"
+)
+
+// ssaCalls are the calls with a static callee and the interface method calls of
+// the functions of an ssaFuncs, by the position of the left parenthesis of the
+// call.
+type ssaCalls struct {
+	decls map[*types.Func]*ssa.Function
+	calls map[token.Pos][]callee
+}
+
+// newSSACalls resolves the calls of the functions of sf from their SSA form.
+// The calls of the function literals are attributed to the functions which
+// contain them.
+func newSSACalls(sf ssaFuncs) *ssaCalls {
+	sc := &ssaCalls{decls: sf.decls, calls: map[token.Pos][]callee{}}
+	for fn := range sf.funcs {
+		for _, b := range fn.Blocks {
+			for _, instr := range b.Instrs {
+				// the calls, the deferred calls and the go statements
+				call, ok := instr.(ssa.CallInstruction)
+				if !ok {
+					continue
+				}
+
+				common := call.Common()
+				pos := common.Pos()
+				if !pos.IsValid() {
+					continue
+				}
+
+				if c, ok := ssaCallee(common, fn.Pkg.Pkg); ok && !containsCallee(sc.calls[pos], c) {
+					sc.calls[pos] = append(sc.calls[pos], c)
+				}
+			}
+		}
+	}
+
+	for _, callees := range sc.calls {
+		sortCallees(callees)
+	}
+
+	return sc
+}
+
+// ssaCallee returns the callee, without position, of the call common of a
+// function of the package pkg. It returns false if the call doesn't have a
+// static callee nor it's an interface method call.
+func ssaCallee(common *ssa.CallCommon, pkg *types.Package) (callee, bool) {
+	if common.IsInvoke() {
+		return objCallee(common.Method, pkg)
+	}
+
+	if fn := common.StaticCallee(); fn != nil {
+		return funcCallee(fn, pkg)
+	}
+
+	return callee{}, false
+}
+
+// callees returns the calls of the body of the function declared with the
+// identifier name, with their positions adjusted by the //line directives of
+// fset. typesPkg is the package where the function is declared and typesInfo
+// holds its type information.
+//
+// The builtin functions and the conversions aren't calls in the SSA form and
+// the function values which are assigned once have a static callee in it, so
+// they are resolved as the AST backend does, which leaves the calls through
+// function values to indirectCalls, and so are the embedding types of the
+// promoted methods and the implicit dereferences of the receivers. The calls
+// of unreachable code, e.g. after a return statement, aren't in the SSA form,
+// so they are resolved as the AST backend does too. It returns false if sc is
+// nil or the function doesn't have SSA form, e.g. because its package has type
+// errors.
+func (sc *ssaCalls) callees(
+	name *ast.Ident, body *ast.BlockStmt, typesPkg *types.Package, typesInfo *types.Info, fset *token.FileSet,
+) ([]callee, bool) {
+	if sc == nil {
+		return nil, false
+	}
+
+	obj, ok := typesInfo.Defs[name].(*types.Func)
+	if !ok || sc.decls[obj] == nil {
+		return nil, false
+	}
+
+	var callees []callee
+	ast.Inspect(body, func(n ast.Node) bool {
+		callExpr, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+
+		pos := fset.Position(callExpr.Pos())
+		tv := typesInfo.Types[callExpr.Fun]
+		calls, ok := sc.calls[callExpr.Lparen]
+		if !ok || tv.IsBuiltin() || tv.IsType() || !isDirectCall(callExpr, typesInfo) {
+			if c, ok := astCallee(callExpr, typesPkg, typesInfo); ok {
+				c.Pos = pos
+				callees = append(callees, c)
+			}
+
+			return true
+		}
+
+		for _, c := range calls {
+			if c.Kind == calleeMethod {
+				if ac, ok := astCallee(callExpr, typesPkg, typesInfo); ok && ac.Kind == calleeMethod &&
+					ac.Pkg == c.Pkg && ac.Receiver == c.Receiver {
+					c.EmbeddingPkg, c.EmbeddingReceiver = ac.EmbeddingPkg, ac.EmbeddingReceiver
+					c.Deref = ac.Deref
+				}
+			}
+
+			c.Pos = pos
+			callees = append(callees, c)
+		}
+
+		return true
+	})
+
+	return callees, true
+}
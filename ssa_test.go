@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackendsParity(t *testing.T) {
+	// the wildcards don't match the testdata directories
+	pkgs, err := loadPackages("", []string{
+		"./testdata/testpkg", "./testdata/suppressed", "./testdata/linedir", "./testdata/generated",
+		"./testdata/imports", "./testdata/embedded", "./testdata/refs", "./testdata/indirect",
+		"./testdata/recvkind", "./testdata/unreachable",
+	})
+	require.NoError(t, err)
+	require.Len(t, pkgs, 10)
+
+	astIdxs, err := indexPackages(pkgs, indexOptions{backend: backendAST, indirect: true}, 0)
+	require.NoError(t, err)
+
+	ssaIdxs, err := indexPackages(pkgs, indexOptions{backend: backendSSA, indirect: true}, 0)
+	require.NoError(t, err)
+
+	require.Len(t, ssaIdxs, len(astIdxs))
+	for i := range astIdxs {
+		assert.Equal(t, astIdxs[i], ssaIdxs[i], astIdxs[i].PkgPath)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+	"sync"
+)
+
+// suppressionDirective is the prefix of the comments which suppress the
+// functions which match a rule. The comment format is
+// "//findfuncs:ignore <rule> <reason>".
+const suppressionDirective = "//findfuncs:ignore"
+
+// suppressFunc reports if the function fn, whose calls to the matched function
+// calls are in callsPos, is suppressed.
+type suppressFunc func(fn *funcIndex, callsPos []token.Position) bool
+
+// suppression is a comment which suppresses the functions which match a rule.
+type suppression struct {
+	rule   string
+	reason string
+	pos    token.Position
+	// pkgPath is the path of the package where the suppression is.
+	pkgPath string
+	// used indicates if the suppression has suppressed some function.
+	used bool
+}
+
+// suppressions indexes the suppression comments by filename and line. It's
+// safe for concurrent use.
+type suppressions struct {
+	byLine map[string]map[int][]*suppression
+	list   []*suppression
+	// mu protects the used field of the suppressions.
+	mu sync.Mutex
+}
+
+// collectSuppressions collects the suppression comments of the files of idxs
+// which keepFile keeps, so the ones of the skipped files aren't reported as
+// unused. nil keepFile means all the files. It returns the warnings for the
+// suppression comments which are malformed.
+func collectSuppressions(idxs []*pkgIndex, keepFile fileFilter) (*suppressions, []string) {
+	var (
+		sups = &suppressions{
+			byLine: map[string]map[int][]*suppression{},
+		}
+		warns []string
+	)
+	for _, idx := range idxs {
+		for i := range idx.Files {
+			fi := &idx.Files[i]
+			if keepFile != nil && !keepFile(fi) {
+				continue
+			}
+
+			for _, d := range fi.Directives {
+				fields := strings.Fields(strings.TrimPrefix(d.Text, suppressionDirective))
+				if len(fields) < 2 {
+					warns = append(warns, fmt.Sprintf(
+						"%s: malformed suppression comment, format is '%s <rule> <reason>'",
+						d.Pos, suppressionDirective,
+					))
+					continue
+				}
+
+				sups.add(&suppression{
+					rule:    fields[0],
+					reason:  strings.Join(fields[1:], " "),
+					pos:     d.Pos,
+					pkgPath: idx.PkgPath,
+				})
+			}
+		}
+	}
+
+	return sups, warns
+}
+
+func (sups *suppressions) add(s *suppression) {
+	lines, ok := sups.byLine[s.pos.Filename]
+	if !ok {
+		lines = map[int][]*suppression{}
+		sups.byLine[s.pos.Filename] = lines
+	}
+
+	lines[s.pos.Line] = append(lines[s.pos.Line], s)
+	sups.list = append(sups.list, s)
+}
+
+// suppressFunc returns the function which reports the functions suppressed
+// for the rule with ruleName.
+//
+// A function is suppressed when a suppression comment of the rule is in its
+// documentation, in the line of its declaration or the line above, or in the
+// line of one of the matched calls or the line above. The suppressions which
+// suppress a function are marked as used.
+//
+// It returns nil if sups is nil.
+func (sups *suppressions) suppressFunc(ruleName string) suppressFunc {
+	if sups == nil {
+		return nil
+	}
+
+	return func(fn *funcIndex, callsPos []token.Position) bool {
+		fromLine := fn.Start.Line - 1
+		if fn.DocLine > 0 {
+			fromLine = fn.DocLine
+		}
+
+		suppressed := sups.markUsed(ruleName, fn.Start.Filename, fromLine, fn.Start.Line)
+		for _, pos := range callsPos {
+			if sups.markUsed(ruleName, pos.Filename, pos.Line-1, pos.Line) {
+				suppressed = true
+			}
+		}
+
+		return suppressed
+	}
+}
+
+// markUsed marks as used the suppressions of the rule ruleName placed in
+// filename between the lines fromLine and toLine, both included. It returns
+// true if there is any.
+func (sups *suppressions) markUsed(ruleName string, filename string, fromLine, toLine int) bool {
+	lines, ok := sups.byLine[filename]
+	if !ok {
+		return false
+	}
+
+	sups.mu.Lock()
+	defer sups.mu.Unlock()
+
+	var found bool
+	for l := fromLine; l <= toLine; l++ {
+		for _, s := range lines[l] {
+			if s.rule == ruleName {
+				s.used = true
+				found = true
+			}
+		}
+	}
+
+	return found
+}
+
+// unused returns the warnings for the suppressions which haven't suppressed
+// any function. Only the suppressions of the evaluated rules, in the packages
+// which they apply to, are checked, because the rest couldn't suppress
+// anything. When allRules is true, rules are all the rules of the project, so
+// the suppressions of any other rule are reported as unknown, e.g. because of
+// a typo.
+func (sups *suppressions) unused(rules []rule, allRules bool) []string {
+	sups.mu.Lock()
+	defer sups.mu.Unlock()
+
+	var warns []string
+	for _, s := range sups.list {
+		var evaluated, applies bool
+		for _, r := range rules {
+			if r.name == s.rule {
+				evaluated = true
+				applies = applies || r.appliesTo(s.pkgPath)
+			}
+		}
+
+		switch {
+		case !evaluated && allRules:
+			warns = append(warns, fmt.Sprintf("%s: suppression of unknown rule %q", s.pos, s.rule))
+		case applies && !s.used:
+			warns = append(warns, fmt.Sprintf(
+				"%s: suppression of rule %q doesn't suppress anything", s.pos, s.rule,
+			))
+		}
+	}
+
+	return warns
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunSuppressions(t *testing.T) {
+	const pkg = "github.com/ifraixedes/find-funcs-with-set-funcs-calls/testdata/suppressed"
+
+	t.Run("without reporting suppressed", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-funcs", "strings.Compare", pkg}, &stdout, &stderr)
+		require.Equal(t, exitCodeOK, code, "stderr: %s", stderr.String())
+
+		out := stdout.String()
+		assert.Contains(t, out, ": notSuppressed: default[warning]\n")
+		assert.Contains(t, out, ": suppressedOtherRule: default[warning]\n")
+		assert.Contains(t, out, ": malformedSuppression: default[warning]\n")
+		assert.NotContains(t, out, "suppressedIn")
+		assert.Equal(t, 3, strings.Count(out, "\n"))
+
+		warns := stderr.String()
+		assert.NotContains(t, warns, `"other"`, "the rule isn't evaluated")
+		assert.Contains(t, warns, "suppressed.go:38:")
+		assert.Contains(t, warns, `suppression of rule "default" doesn't suppress anything`)
+		assert.Contains(t, warns, "suppressed.go:42:")
+		assert.Contains(t, warns, "malformed suppression comment")
+		assert.Equal(t, 2, strings.Count(warns, "\n"))
+	})
+
+	writeConfig := func(t *testing.T, rules string) string {
+		t.Helper()
+
+		filename := filepath.Join(t.TempDir(), "rules.json")
+		require.NoError(t, os.WriteFile(filename, []byte(`{"rules": [`+rules+`]}`), 0o644))
+		return filename
+	}
+
+	t.Run("unknown rule", func(t *testing.T) {
+		config := writeConfig(t, `{"name": "default", "funcs": ["strings.Compare"]}`)
+
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-config", config, pkg}, &stdout, &stderr)
+		require.Equal(t, exitCodeOK, code, "stderr: %s", stderr.String())
+
+		warns := stderr.String()
+		assert.Contains(t, warns, `suppressed.go:32:1: suppression of unknown rule "other"`)
+		assert.Contains(t, warns, `suppressed.go:38:`)
+		assert.Equal(t, 3, strings.Count(warns, "\n"))
+	})
+
+	t.Run("rule which doesn't apply to the package", func(t *testing.T) {
+		config := writeConfig(t, `
+			{"name": "default", "funcs": ["strings.Compare"]},
+			{"name": "other", "funcs": ["strings.Compare"], "exclude": ["`+pkg+`"]}`,
+		)
+
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-config", config, pkg}, &stdout, &stderr)
+		require.Equal(t, exitCodeOK, code, "stderr: %s", stderr.String())
+
+		warns := stderr.String()
+		assert.NotContains(t, warns, `"other"`)
+		assert.Equal(t, 2, strings.Count(warns, "\n"))
+	})
+
+	t.Run("reporting suppressed", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-report-suppressed", "-fail-on-match", "-funcs", "strings.Compare", pkg}, &stdout, &stderr)
+		require.Equal(t, exitCodeMatches, code, "stderr: %s", stderr.String())
+
+		out := stdout.String()
+		for _, fn := range []string{"suppressedInDecl", "suppressedInDoc", "suppressedInCall", "suppressedInCallAbove"} {
+			assert.Contains(t, out, ": "+fn+": default[warning] (suppressed)\n")
+		}
+		assert.Equal(t, 7, strings.Count(out, "\n"))
+		assert.Contains(t, stderr.String(), "found 3 matching functions")
+	})
+}
@@ -0,0 +1,43 @@
+package embedded
+
+import (
+	"bytes"
+	"io"
+)
+
+type buffer struct {
+	bytes.Buffer
+}
+
+func (b *buffer) reset() {
+	b.Buffer.Reset()
+}
+
+type wrapper struct {
+	*buffer
+	rc io.ReadCloser
+}
+
+func resetBuffer(b *buffer) {
+	b.Reset()
+}
+
+func resetWrapper(w wrapper) {
+	w.Reset()
+}
+
+func resetWrapperBuffer(w wrapper) {
+	w.buffer.Reset()
+}
+
+func resetPromotedField(w wrapper) {
+	w.Buffer.Reset()
+}
+
+func resetUnexported(w wrapper) {
+	w.reset()
+}
+
+func read(w wrapper) {
+	w.rc.Read(nil)
+}
@@ -0,0 +1,9 @@
+package generated
+
+import "strconv"
+
+type color int
+
+func (c color) code() string {
+	return strconv.Itoa(int(c))
+}
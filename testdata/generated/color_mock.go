@@ -0,0 +1,7 @@
+package generated
+
+import "strconv"
+
+func mockColorCode() string {
+	return strconv.Itoa(1)
+}
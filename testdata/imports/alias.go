@@ -0,0 +1,14 @@
+package imports
+
+import (
+	"path"
+	fp "path/filepath"
+)
+
+func aliasJoin() string {
+	return fp.Join("a", "b")
+}
+
+func pathJoin() string {
+	return path.Join("a", "b")
+}
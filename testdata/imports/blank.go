@@ -0,0 +1,7 @@
+package imports
+
+import _ "strings"
+
+func blankCompare() int {
+	return strings.Compare("a", "b")
+}
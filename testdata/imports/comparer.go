@@ -0,0 +1,10 @@
+package imports
+
+// strings shadows the name of the package imported with the blank identifier.
+var strings comparer
+
+type comparer struct{}
+
+func (comparer) Compare(a, b string) int {
+	return len(a) - len(b)
+}
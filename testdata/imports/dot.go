@@ -0,0 +1,7 @@
+package imports
+
+import . "strings"
+
+func dotCompare() int {
+	return Compare("a", "b")
+}
@@ -0,0 +1,47 @@
+package indirect
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+type config struct {
+	Logger func(format string, v ...interface{})
+}
+
+func newConfig() config {
+	return config{Logger: log.Printf}
+}
+
+func logStart(cfg config) {
+	cfg.Logger("start")
+}
+
+var hook = func() {}
+
+func setHook() {
+	hook = func() { fmt.Println("hook") }
+}
+
+func runHook() {
+	hook()
+}
+
+func localVar(s string) string {
+	upper := strings.ToUpper
+	return upper(s)
+}
+
+func callAndLocalVar(s string) string {
+	upper := strings.ToUpper
+	return upper(strings.ToUpper(s))
+}
+
+func callResult() {
+	newLogger()("start")
+}
+
+func newLogger() func(format string, v ...interface{}) {
+	return log.Printf
+}
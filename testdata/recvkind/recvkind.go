@@ -0,0 +1,33 @@
+package recvkind
+
+type T struct{}
+
+func (T) Value() {}
+
+func (*T) Pointer() {}
+
+type E struct{ *T }
+
+func valueOnValue(t T) {
+	t.Value()
+}
+
+func valueOnPointer(p *T) {
+	p.Value()
+}
+
+func valueOnEmbeddedPointer(e E) {
+	e.Value()
+}
+
+func valueMethodExpression(p *T) {
+	(*T).Value(p)
+}
+
+func pointerOnAddressable(t T) {
+	t.Pointer()
+}
+
+func pointerOnPointer(p *T) {
+	p.Pointer()
+}
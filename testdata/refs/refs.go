@@ -0,0 +1,57 @@
+package refs
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+func methodValue(buf *bytes.Buffer) {
+	f := buf.Reset
+	f()
+}
+
+func methodExpression(buf *bytes.Buffer) {
+	f := (*bytes.Buffer).Reset
+	f(buf)
+}
+
+func callMethodExpression(buf *bytes.Buffer) {
+	(*bytes.Buffer).Reset(buf)
+}
+
+func callAndValue(buf *bytes.Buffer) {
+	buf.Reset()
+	_ = buf.Reset
+}
+
+func less(a, b string) bool {
+	return strings.Compare(a, b) < 0
+}
+
+func callInFuncLit(s []string) {
+	sort.Slice(s, func(i, j int) bool { return less(s[i], s[j]) })
+}
+
+func argument(s []string) {
+	sortStrings(s, less)
+}
+
+func sortStrings(s []string, fn func(a, b string) bool) {
+	sort.Slice(s, func(i, j int) bool { return fn(s[i], s[j]) })
+}
+
+func upper(s []string) {
+	apply(s, strings.ToUpper)
+}
+
+func apply(s []string, fn func(string) string) {
+	for i := range s {
+		s[i] = fn(s[i])
+	}
+}
+
+func callAndArgument(buf *bytes.Buffer, s []string) {
+	buf.Reset()
+	apply(s, strings.ToUpper)
+}
@@ -0,0 +1,45 @@
+package suppressed
+
+import (
+	"strings"
+)
+
+func notSuppressed() {
+	strings.Compare("a", "b")
+}
+
+//findfuncs:ignore default it's a known case
+func suppressedInDecl() {
+	strings.Compare("a", "b")
+}
+
+// suppressedInDoc is suppressed in its documentation.
+//
+//findfuncs:ignore default it's a known case
+func suppressedInDoc() {
+	strings.Compare("a", "b")
+}
+
+func suppressedInCall() {
+	strings.Compare("a", "b") //findfuncs:ignore default it's a known case
+}
+
+func suppressedInCallAbove() {
+	//findfuncs:ignore default it's a known case
+	strings.Compare("a", "b")
+}
+
+//findfuncs:ignore other it's for another rule
+func suppressedOtherRule() {
+	strings.Compare("a", "b")
+}
+
+func unusedSuppression() {
+	//findfuncs:ignore default it doesn't suppress anything
+	_ = strings.ToLower("a")
+}
+
+//findfuncs:ignore default
+func malformedSuppression() {
+	strings.Compare("a", "b")
+}
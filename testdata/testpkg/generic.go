@@ -0,0 +1,22 @@
+package testpkg
+
+import "net/http/cookiejar"
+
+type genericType[T any] struct {
+	val T
+}
+
+func (g *genericType[T]) pointerMethod() {
+	jar, _ := cookiejar.New(nil)
+	_ = jar
+}
+
+func (g genericType[T]) valueMethod() T {
+	return g.val
+}
+
+type genericPair[K comparable, V any] map[K]V
+
+func (p genericPair[K, V]) get(k K) V {
+	return p[k]
+}
@@ -0,0 +1,23 @@
+package unreachable
+
+import "strings"
+
+func afterReturn(s string) {
+	return
+	strings.ToUpper(s)
+}
+
+func afterEndlessFor(s string) {
+	for {
+	}
+	strings.ToUpper(s)
+}
+
+func afterPanic(s string) {
+	panic(s)
+	strings.ToUpper(s)
+}
+
+func reachable(s string) string {
+	return strings.ToUpper(s)
+}
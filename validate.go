@@ -0,0 +1,333 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// maxSuggestions is the maximum number of suggestions reported for an unknown
+// package, type or function.
+const maxSuggestions = 3
+
+// typesPackages are the type information of a set of packages by their path.
+// The packages whose type information isn't loaded only have their path and
+// name and they aren't complete, e.g. when their indexes are read from the
+// cache, so only their existence is checked. The packages which exist but aren't imported
+// by the analyzed packages are nil, see withUnimported.
+type typesPackages map[string]*types.Package
+
+// newTypesPackages returns the type information of pkgs and all their
+// dependencies.
+func newTypesPackages(pkgs []*packages.Package) typesPackages {
+	tp := typesPackages{}
+	packages.Visit(pkgs, nil, func(p *packages.Package) {
+		if p.Types != nil {
+			tp[p.PkgPath] = p.Types
+		} else {
+			tp[p.PkgPath] = types.NewPackage(p.PkgPath, p.Name)
+		}
+	})
+
+	return tp
+}
+
+// withUnimported returns tp with the packages of the funcCalls of rules which
+// aren't in tp, but can be loaded relative to dir, added as nil, so they are
+// reported as not imported by the analyzed packages instead of unknown. It
+// returns tp itself when there isn't any.
+func (tp typesPackages) withUnimported(dir string, rules []rule) typesPackages {
+	var (
+		paths []string
+		seen  = map[string]bool{}
+	)
+	for _, r := range rules {
+		for _, fc := range r.funcCalls {
+			if _, ok := tp[fc.pkg]; !ok && fc.pkg != analyzedPkg && !seen[fc.pkg] {
+				seen[fc.pkg] = true
+				paths = append(paths, fc.pkg)
+			}
+		}
+	}
+
+	if len(paths) == 0 {
+		return tp
+	}
+
+	// the paths which cannot be loaded are unknown
+	pkgs, err := packages.Load(&packages.Config{Dir: dir, Mode: packages.NeedName}, paths...)
+	if err != nil {
+		return tp
+	}
+
+	utp := make(typesPackages, len(tp)+len(pkgs))
+	for path, pkg := range tp {
+		utp[path] = pkg
+	}
+
+	for _, p := range pkgs {
+		if len(p.Errors) == 0 && seen[p.PkgPath] {
+			utp[p.PkgPath] = nil
+		}
+	}
+
+	return utp
+}
+
+// checkRules returns the problems of the funcCalls of rules, with the name of
+// the rule which they belong to, according to checkFuncCalls.
+func (tp typesPackages) checkRules(rules []rule) []string {
+	var msgs []string
+	for _, r := range rules {
+		for _, msg := range tp.checkFuncCalls(r.funcCalls) {
+			msgs = append(msgs, fmt.Sprintf("rule %q: %s", r.name, msg))
+		}
+	}
+
+	return msgs
+}
+
+// checkFuncCalls resolves each of fcalls against the scopes and method sets
+// of tp and returns a message for each one which refers to a package, type,
+// function or method which doesn't exist, with the most similar names of the
+// same kind as suggestions. The funcCalls which match nothing are most of the
+// times typos which would silently yield zero results.
+func (tp typesPackages) checkFuncCalls(fcalls []funcCall) []string {
+	var msgs []string
+	for _, fc := range fcalls {
+		if msg := tp.checkFuncCall(fc); msg != "" {
+			msgs = append(msgs, msg)
+		}
+	}
+
+	return msgs
+}
+
+// checkFuncCall returns the problem of fc or an empty string if fc exists.
+func (tp typesPackages) checkFuncCall(fc funcCall) string {
+	if fc.pkg == analyzedPkg {
+		// it refers to a different package for each analyzed package
+		return ""
+	}
+
+	pkg, ok := tp[fc.pkg]
+	if !ok {
+		paths := make([]string, 0, len(tp))
+		for path := range tp {
+			paths = append(paths, path)
+		}
+
+		return fmt.Sprintf("unknown package %q%s", fc.pkg, didYouMean(fc.pkg, paths))
+	}
+
+	if pkg == nil {
+		return fmt.Sprintf("package %q isn't imported by the analyzed packages", fc.pkg)
+	}
+
+	if !pkg.Complete() {
+		// without type information only the package can be checked
+		return ""
+	}
+
+	scope := pkg.Scope()
+	if fc.receiver == "" {
+		if isFuncObject(scope.Lookup(fc.funcName)) {
+			return ""
+		}
+
+		var names []string
+		for _, name := range scope.Names() {
+			if isFuncObject(scope.Lookup(name)) {
+				names = append(names, name)
+			}
+		}
+
+		return fmt.Sprintf("unknown function %q in package %q%s",
+			fc.funcName, fc.pkg, didYouMean(fc.funcName, names),
+		)
+	}
+
+	tn, ok := scope.Lookup(fc.receiver).(*types.TypeName)
+	if !ok {
+		var names []string
+		for _, name := range scope.Names() {
+			if _, ok := scope.Lookup(name).(*types.TypeName); ok {
+				names = append(names, name)
+			}
+		}
+
+		return fmt.Sprintf("unknown type %q in package %q%s",
+			fc.receiver, fc.pkg, didYouMean(fc.receiver, names),
+		)
+	}
+
+	var names []string
+	for _, sel := range methodSet(tn.Type()) {
+		if sel.Obj().Name() == fc.funcName {
+			return checkRecvKind(fc, tn, sel)
+		}
+
+		names = append(names, sel.Obj().Name())
+	}
+
+	return fmt.Sprintf("unknown method %q of type %q%s",
+		fc.funcName, fc.pkg+"."+fc.receiver, didYouMean(fc.funcName, names),
+	)
+}
+
+// checkRecvKind returns the problem of the receiver kind of fc, whose method
+// is the selection sel of the type tn, or an empty string if fc may match,
+// according to the method set rules.
+func checkRecvKind(fc funcCall, tn *types.TypeName, sel *types.Selection) string {
+	typeName := fc.pkg + "." + fc.receiver
+	switch {
+	case fc.recvKind == recvPointer && types.IsInterface(tn.Type()):
+		either := fc
+		either.recvKind = recvEither
+		return fmt.Sprintf("the pointers to interface type %q have no methods, did you mean %q?",
+			typeName, funcCallName(either),
+		)
+	case fc.recvKind == recvValue && isPointer(sel.Obj().Type().(*types.Signature).Recv().Type()):
+		ptr := fc
+		ptr.recvKind = recvPointer
+		return fmt.Sprintf("method %q of type %q has a pointer receiver, did you mean %q?",
+			fc.funcName, typeName, funcCallName(ptr),
+		)
+	default:
+		return ""
+	}
+}
+
+// isFuncObject returns true if obj is a function or a variable of a function
+// type, which can be called as a function.
+func isFuncObject(obj types.Object) bool {
+	switch obj := obj.(type) {
+	case *types.Func:
+		return true
+	case *types.Var:
+		_, ok := obj.Type().Underlying().(*types.Signature)
+		return ok
+	default:
+		return false
+	}
+}
+
+// methodSet returns the methods which can be called on the values of typ,
+// which are the ones of the method set of *typ unless it's an interface.
+func methodSet(typ types.Type) []*types.Selection {
+	if !types.IsInterface(typ) {
+		typ = types.NewPointer(typ)
+	}
+
+	mset := types.NewMethodSet(typ)
+	sels := make([]*types.Selection, mset.Len())
+	for i := range sels {
+		sels[i] = mset.At(i)
+	}
+
+	return sels
+}
+
+// didYouMean returns the suggestion of the candidates which are most similar
+// to name, formatted for being appended to a message, or an empty string if
+// none of them is similar enough.
+func didYouMean(name string, candidates []string) string {
+	suggestions := suggest(name, candidates)
+	if len(suggestions) == 0 {
+		return ""
+	}
+
+	quoted := make([]string, len(suggestions))
+	for i, s := range suggestions {
+		quoted[i] = fmt.Sprintf("%q", s)
+	}
+
+	return fmt.Sprintf(", did you mean %s?", strings.Join(quoted, " or "))
+}
+
+// suggest returns, at most maxSuggestions, the candidates whose edit distance
+// to name is the lowest, as long as it's at most a third of the length of
+// name, or one for the short names. The comparison is case insensitive, so a
+// wrong capitalization is always suggested.
+func suggest(name string, candidates []string) []string {
+	maxDist := len(name) / 3
+	if maxDist < 1 {
+		maxDist = 1
+	}
+
+	type scored struct {
+		name string
+		dist int
+	}
+
+	var similar []scored
+	for _, c := range candidates {
+		if c == name {
+			continue
+		}
+
+		d := editDistance(strings.ToLower(name), strings.ToLower(c))
+		if d <= maxDist {
+			similar = append(similar, scored{name: c, dist: d})
+		}
+	}
+
+	sort.Slice(similar, func(i, j int) bool {
+		if similar[i].dist != similar[j].dist {
+			return similar[i].dist < similar[j].dist
+		}
+
+		return similar[i].name < similar[j].name
+	})
+
+	if len(similar) > maxSuggestions {
+		similar = similar[:maxSuggestions]
+	}
+
+	suggestions := make([]string, len(similar))
+	for i, s := range similar {
+		suggestions[i] = s.name
+	}
+
+	return suggestions
+}
+
+// editDistance returns the optimal string alignment distance between a and b,
+// i.e. the minimum number of single byte insertions, deletions, substitutions
+// or transpositions of adjacent bytes for changing a into b, where no
+// substring is edited more than once.
+func editDistance(a string, b string) int {
+	var (
+		prev2 = make([]int, len(b)+1)
+		prev  = make([]int, len(b)+1)
+		cur   = make([]int, len(b)+1)
+	)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	return prev[len(b)]
+}
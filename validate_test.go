@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"go/types"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditDistance(t *testing.T) {
+	testCases := []struct {
+		a, b string
+		dist int
+	}{
+		{a: "", b: "", dist: 0},
+		{a: "abc", b: "", dist: 3},
+		{a: "", b: "abc", dist: 3},
+		{a: "Compare", b: "Compare", dist: 0},
+		{a: "Compar", b: "Compare", dist: 1},
+		{a: "Bufer", b: "Buffer", dist: 1},
+		{a: "kitten", b: "sitting", dist: 3},
+		{a: "strigns", b: "strings", dist: 1},
+		{a: "Itao", b: "Itoa", dist: 1},
+		{a: "ca", b: "abc", dist: 3},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.a+"/"+tc.b, func(t *testing.T) {
+			assert.Equal(t, tc.dist, editDistance(tc.a, tc.b))
+			assert.Equal(t, tc.dist, editDistance(tc.b, tc.a))
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"Compare", "Contains", "ContainsAny", "Count", "Index", "compare"}
+
+	assert.Equal(t, []string{"Compare", "compare"}, suggest("Compar", candidates))
+	assert.Equal(t, []string{"Compare", "compare"}, suggest("COMPARE", candidates))
+	assert.Equal(t, []string{"Contains"}, suggest("Contain", candidates))
+	assert.Equal(t, []string{"Count"}, suggest("Cont", candidates))
+	assert.Empty(t, suggest("Split", candidates))
+	assert.Empty(t, suggest("Compare", []string{"Compare"}))
+	assert.Len(t, suggest("a", []string{"b", "c", "d", "e"}), maxSuggestions)
+
+	assert.Equal(t, `, did you mean "Compare" or "compare"?`, didYouMean("Compar", candidates))
+	assert.Equal(t, "", didYouMean("Split", candidates))
+}
+
+func TestCheckFuncCalls(t *testing.T) {
+	modDir, writeFile := newWatchModule(t)
+	writeFile("b/b.go", `package b
+
+import (
+	"bytes"
+	"io"
+)
+
+var Hook = func() {}
+
+var Value = 1
+
+type T struct{ bytes.Buffer }
+
+func (T) M() {}
+
+func F(r io.Reader, b *bytes.Buffer) {}
+`)
+
+	pkgs, err := loadPackages(modDir, []string{"./..."})
+	require.NoError(t, err)
+	tp := newTypesPackages(pkgs)
+
+	testCases := []struct {
+		desc string
+		spec string
+		msg  string
+	}{
+		{desc: "function", spec: "strings.Compare"},
+		{desc: "method", spec: "bytes.Buffer.Reset"},
+		{desc: "interface method", spec: "io.Reader.Read"},
+		{desc: "promoted method", spec: "example.com/watchtest/b.T.Reset"},
+		{desc: "value receiver method", spec: "example.com/watchtest/b.T.M"},
+		{desc: "function variable", spec: "example.com/watchtest/b.Hook"},
+		{desc: "value receiver method through a value", spec: "(example.com/watchtest/b.T).M"},
+		{desc: "value receiver method through a pointer", spec: "(*example.com/watchtest/b.T).M"},
+		{desc: "pointer receiver method through a pointer", spec: "(*bytes.Buffer).Reset"},
+		{desc: "interface method through a value", spec: "(io.Reader).Read"},
+		{
+			desc: "pointer receiver method through a value",
+			spec: "(bytes.Buffer).Reset",
+			msg:  `method "Reset" of type "bytes.Buffer" has a pointer receiver, did you mean "(*bytes.Buffer).Reset"?`,
+		},
+		{
+			desc: "promoted pointer receiver method through a value",
+			spec: "(example.com/watchtest/b.T).Reset",
+			msg: `method "Reset" of type "example.com/watchtest/b.T" has a pointer receiver, ` +
+				`did you mean "(*example.com/watchtest/b.T).Reset"?`,
+		},
+		{
+			desc: "interface method through a pointer",
+			spec: "(*io.Reader).Read",
+			msg:  `the pointers to interface type "io.Reader" have no methods, did you mean "io.Reader.Read"?`,
+		},
+		{
+			desc: "unknown package",
+			spec: "strigns.Compare",
+			msg:  `unknown package "strigns", did you mean "strings"?`,
+		},
+		{
+			desc: "unknown package without suggestions",
+			spec: "example.com/other.F",
+			msg:  `unknown package "example.com/other"`,
+		},
+		{
+			desc: "unknown function",
+			spec: "strings.Compar",
+			msg:  `unknown function "Compar" in package "strings", did you mean "Compare"?`,
+		},
+		{
+			desc: "variable which isn't a function",
+			spec: "example.com/watchtest/b.Value",
+			msg:  `unknown function "Value" in package "example.com/watchtest/b"`,
+		},
+		{
+			desc: "unknown type",
+			spec: "bytes.Bufer.Bytes",
+			msg:  `unknown type "Bufer" in package "bytes", did you mean "Buffer"?`,
+		},
+		{
+			desc: "unknown method",
+			spec: "bytes.Buffer.Byts",
+			msg:  `unknown method "Byts" of type "bytes.Buffer", did you mean "Bytes"?`,
+		},
+		{
+			desc: "function used as type",
+			spec: "strings.Compare.Compare",
+			msg:  `unknown type "Compare" in package "strings"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			fcalls, err := parseFuncCalls(tc.spec)
+			require.NoError(t, err)
+
+			msgs := tp.checkFuncCalls(fcalls)
+			if tc.msg == "" {
+				assert.Empty(t, msgs)
+				return
+			}
+
+			assert.Equal(t, []string{tc.msg}, msgs)
+		})
+	}
+
+	t.Run("without type information", func(t *testing.T) {
+		tp := typesPackages{"strings": types.NewPackage("strings", "strings")}
+		fcalls, err := parseFuncCalls("strings.Compar,strigns.Compare")
+		require.NoError(t, err)
+
+		assert.Equal(t,
+			[]string{`unknown package "strigns", did you mean "strings"?`}, tp.checkFuncCalls(fcalls),
+		)
+	})
+}
+
+func TestRunUnimportedPackage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-sub", "1", "-funcs", "strconv.Itoa,bytes.Compare,strigns.Compare", "./testdata/generated"},
+		&stdout, &stderr,
+	)
+	require.Equal(t, exitCodeOK, code, stderr.String())
+	assert.Contains(t, stderr.String(),
+		"warning: rule \"default\": package \"bytes\" isn't imported by the analyzed packages\n",
+	)
+	assert.Contains(t, stderr.String(), "warning: rule \"default\": unknown package \"strigns\"")
+	assert.NotEmpty(t, stdout.String())
+}
+
+func TestRunUnknownFuncs(t *testing.T) {
+	// The second run with the cache reads the packages from it, so only the
+	// packages of the funcs are checked.
+	const unknownFunc = "warning: rule \"default\": unknown function \"Itao\" in package \"strconv\", did you mean \"Itoa\"?\n"
+	cacheDir := t.TempDir()
+	for _, tc := range []struct {
+		cache bool
+		funcs bool
+	}{
+		{cache: false, funcs: true},
+		{cache: true, funcs: true},
+		{cache: true, funcs: false},
+	} {
+		args := []string{"-funcs", "strconv.Itao,strconv.Itoa,strigns.Compare", "-sub", "1"}
+		if tc.cache {
+			args = append(args, "-cache", cacheDir)
+		}
+
+		var stdout, stderr bytes.Buffer
+		code := run(append(args, "./testdata/generated"), &stdout, &stderr)
+		require.Equal(t, exitCodeOK, code, stderr.String())
+		if tc.funcs {
+			assert.Contains(t, stderr.String(), unknownFunc)
+		} else {
+			assert.NotContains(t, stderr.String(), "Itao")
+		}
+		assert.Contains(t, stderr.String(), "warning: rule \"default\": unknown package \"strigns\"")
+		assert.NotEmpty(t, stdout.String())
+	}
+}
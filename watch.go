@@ -0,0 +1,488 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/tools/go/packages"
+)
+
+// watchDebounce is the time to wait since the last file change before
+// evaluating the rules again, so a burst of changes, e.g. when saving several
+// files or checking out a branch, is evaluated once.
+const watchDebounce = 200 * time.Millisecond
+
+// watcher keeps the loaded packages and the matches of the last evaluation of
+// the rules, so when some files change, only the packages affected by them are
+// loaded again.
+type watcher struct {
+	dir  string
+	cmdp cmdParams
+	// pkgs are the packages which match the patterns and idxs their indexes.
+	pkgs []*packages.Package
+	idxs []*pkgIndex
+	// matches are the matches of the last evaluation by their key.
+	matches map[string]funcResult
+}
+
+// watchChanges are the matches which appeared and disappeared between two
+// evaluations of the rules.
+type watchChanges struct {
+	Added   []funcResult `json:"added"`
+	Removed []funcResult `json:"removed"`
+}
+
+// newWatcher loads the packages which match the patterns of cmdp, relative to
+// dir, and evaluates the rules. It returns the results of the evaluation.
+func newWatcher(dir string, cmdp cmdParams) (*watcher, []ruleResult, error) {
+	w := &watcher{dir: dir, cmdp: cmdp}
+	if err := w.loadAll(); err != nil {
+		return nil, nil, err
+	}
+
+	rules, err := resolvePkgNames(cmdp.rules, w.idxs, newTypesPackages(w.pkgs))
+	if err != nil {
+		return nil, nil, err
+	}
+	w.cmdp.rules = rules
+
+	results, _, err := w.evaluate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return w, results, nil
+}
+
+// loadAll loads and indexes all the packages which match the patterns.
+func (w *watcher) loadAll() error {
+	pkgs, err := loadPackages(w.dir, w.cmdp.pkgsPatterns)
+	if err != nil {
+		return err
+	}
+
+	idxs, err := indexPackages(pkgs, w.cmdp.indexOptions(), w.cmdp.workers)
+	if err != nil {
+		return err
+	}
+
+	w.pkgs, w.idxs = pkgs, idxs
+	return nil
+}
+
+// modulePkgs returns the packages which match the patterns and all their
+// dependencies which belong to the same modules, whose changes also change the
+// results, e.g. the local packages which are imported but don't match the
+// patterns.
+func (w *watcher) modulePkgs() []*packages.Package {
+	mods := map[string]bool{}
+	for _, p := range w.pkgs {
+		if p.Module != nil {
+			mods[p.Module.Path] = true
+		}
+	}
+
+	var pkgs []*packages.Package
+	packages.Visit(w.pkgs, nil, func(p *packages.Package) {
+		if p.Module != nil && mods[p.Module.Path] {
+			pkgs = append(pkgs, p)
+		}
+	})
+
+	return pkgs
+}
+
+// dirs returns the directories to watch, which are the ones of the packages
+// returned by modulePkgs, the root directories of their modules and the
+// directories between them, where new packages may be created.
+func (w *watcher) dirs() []string {
+	set := map[string]bool{}
+	for _, p := range w.modulePkgs() {
+		var modDir string
+		if p.Module != nil && p.Module.Dir != "" {
+			modDir = p.Module.Dir
+			set[modDir] = true
+		}
+
+		for _, f := range p.GoFiles {
+			for d := filepath.Dir(f); !set[d]; d = filepath.Dir(d) {
+				set[d] = true
+				if modDir == "" || !strings.HasPrefix(d, modDir+string(filepath.Separator)) {
+					break
+				}
+			}
+		}
+	}
+
+	dirs := make([]string, 0, len(set))
+	for d := range set {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+
+	return dirs
+}
+
+// update loads again the packages affected by the changes of the files
+// filenames and evaluates the rules, returning the results and the matches
+// which have changed. The packages affected are the ones which
+// contain any of the files and the ones which depend on them. All the packages
+// are loaded again when a go.mod file changes, a directory or a Go file which
+// doesn't belong to any package is created, or the rules match indirect calls,
+// because they depend on all the packages.
+func (w *watcher) update(filenames []string) ([]ruleResult, watchChanges, error) {
+	var (
+		dirPkgs   = map[string][]*packages.Package{}
+		changed   = map[string]bool{}
+		reloadAll = indirectRules(w.cmdp.rules)
+	)
+	for _, p := range w.modulePkgs() {
+		for _, f := range p.GoFiles {
+			dirPkgs[filepath.Dir(f)] = append(dirPkgs[filepath.Dir(f)], p)
+		}
+	}
+
+	for _, f := range filenames {
+		base := filepath.Base(f)
+		if base == "go.mod" || base == "go.sum" {
+			reloadAll = true
+			break
+		}
+
+		if fi, err := os.Stat(f); err == nil && fi.IsDir() {
+			reloadAll = true
+			break
+		}
+
+		pkgs, ok := dirPkgs[filepath.Dir(f)]
+		if !ok {
+			reloadAll = true
+			break
+		}
+
+		for _, p := range pkgs {
+			changed[p.PkgPath] = true
+		}
+	}
+
+	if reloadAll {
+		if err := w.loadAll(); err != nil {
+			return nil, watchChanges{}, err
+		}
+	} else if err := w.reload(changed); err != nil {
+		return nil, watchChanges{}, err
+	}
+
+	return w.evaluate()
+}
+
+// reload loads again the packages which match the patterns whose path is in
+// changed and the ones which depend on any package whose path is in changed.
+func (w *watcher) reload(changed map[string]bool) error {
+	if len(changed) == 0 {
+		return nil
+	}
+
+	var (
+		affected = map[*packages.Package]bool{}
+		visit    func(p *packages.Package) bool
+	)
+	visit = func(p *packages.Package) bool {
+		if a, ok := affected[p]; ok {
+			return a
+		}
+
+		// mark it as not affected while visiting it for breaking import cycles
+		affected[p] = false
+		a := changed[p.PkgPath]
+		for _, ip := range p.Imports {
+			if visit(ip) {
+				a = true
+			}
+		}
+
+		affected[p] = a
+		return a
+	}
+
+	var patterns []string
+	for _, p := range w.pkgs {
+		if visit(p) {
+			patterns = append(patterns, p.PkgPath)
+		}
+	}
+
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	pkgs, err := loadPackages(w.dir, patterns)
+	if err != nil {
+		return err
+	}
+
+	idxs, err := indexPackages(pkgs, w.cmdp.indexOptions(), w.cmdp.workers)
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string]int, len(pkgs))
+	for i, p := range pkgs {
+		loaded[p.PkgPath] = i
+	}
+
+	for i, p := range w.pkgs {
+		if j, ok := loaded[p.PkgPath]; ok {
+			w.pkgs[i], w.idxs[i] = pkgs[j], idxs[j]
+		}
+	}
+
+	return nil
+}
+
+// evaluate applies the rules to the indexes of the packages and returns the
+// results and the matches which have changed since the last evaluation.
+func (w *watcher) evaluate() ([]ruleResult, watchChanges, error) {
+	sups, _ := collectSuppressions(w.idxs, w.cmdp.keepFile)
+	results := make([]ruleResult, len(w.cmdp.rules))
+	for i, r := range w.cmdp.rules {
+		results[i] = ruleResult{
+			rule:       r,
+			funcsFiles: findRule(w.idxs, r, sups, findOptions{keepFile: w.cmdp.keepFile}),
+		}
+	}
+
+	frs, err := funcResults(results, w.cmdp.output.withSuppressed)
+	if err != nil {
+		return nil, watchChanges{}, err
+	}
+
+	var (
+		changes watchChanges
+		matches = make(map[string]funcResult, len(frs))
+	)
+	for _, fr := range frs {
+		key := watchKey(fr)
+		matches[key] = fr
+		if _, ok := w.matches[key]; !ok {
+			changes.Added = append(changes.Added, fr)
+		}
+	}
+
+	for key, fr := range w.matches {
+		if _, ok := matches[key]; !ok {
+			changes.Removed = append(changes.Removed, fr)
+		}
+	}
+
+	sortFuncResults(changes.Added, w.cmdp.output.sortBy)
+	sortFuncResults(changes.Removed, w.cmdp.output.sortBy)
+	w.matches = matches
+	return results, changes, nil
+}
+
+// watchKey returns the key which identifies the match fr between evaluations.
+// The position isn't part of the key, so a function which moves inside of its
+// file doesn't appear as removed and added.
+func watchKey(fr funcResult) string {
+	return strings.Join([]string{fr.Rule, fr.Filename, fr.FullName, fmt.Sprint(fr.Suppressed), fmt.Sprint(fr.Ref), fmt.Sprint(fr.Indirect)}, "\x00")
+}
+
+// printWatchChanges writes changes to w according to opts. The text format
+// writes the lines of the added matches prefixed by "+ " and the ones of the
+// removed matches by "- ". The JSON format writes a JSON object per line.
+func printWatchChanges(w io.Writer, opts outputOptions, changes watchChanges) error {
+	if len(changes.Added) == 0 && len(changes.Removed) == 0 {
+		return nil
+	}
+
+	if opts.format == formatJSON {
+		if changes.Added == nil {
+			changes.Added = []funcResult{}
+		}
+		if changes.Removed == nil {
+			changes.Removed = []funcResult{}
+		}
+
+		return json.NewEncoder(w).Encode(changes)
+	}
+
+	for _, c := range []struct {
+		prefix string
+		frs    []funcResult
+	}{{prefix: "- ", frs: changes.Removed}, {prefix: "+ ", frs: changes.Added}} {
+		for _, fr := range c.frs {
+			if _, err := io.WriteString(w, c.prefix); err != nil {
+				return err
+			}
+
+			if err := printResultsText(w, []funcResult{fr}, opts.pathMode); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// runWatch prints the results of cmdp, whose patterns are relative to dir, and
+// then watches the files of the packages for printing the matches which are
+// added and removed when they change. It returns when stop is closed.
+func runWatch(dir string, cmdp cmdParams, stdout io.Writer, stderr io.Writer, stop <-chan struct{}) int {
+	w, results, err := newWatcher(dir, cmdp)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitCodeError
+	}
+
+	if err := printResults(stdout, cmdp.output, results); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitCodeError
+	}
+
+	for _, msg := range newTypesPackages(w.pkgs).withUnimported(dir, w.cmdp.rules).checkRules(w.cmdp.rules) {
+		fmt.Fprintf(stderr, "warning: %s\n", msg)
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Fprintf(stderr, "error while creating file watcher: %v\n", err)
+		return exitCodeError
+	}
+	defer func() { _ = fsw.Close() }()
+
+	watched := map[string]bool{}
+	watchDirs := func() {
+		for _, d := range w.dirs() {
+			if watched[d] {
+				continue
+			}
+
+			if err := fsw.Add(d); err != nil {
+				fmt.Fprintf(stderr, "warning: cannot watch directory %s: %v\n", d, err)
+				continue
+			}
+
+			watched[d] = true
+		}
+	}
+	watchTree := func(root string) {
+		_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return nil
+			}
+
+			if path != root && ignoredDir(d.Name()) {
+				return filepath.SkipDir
+			}
+
+			if !watched[path] {
+				if err := fsw.Add(path); err != nil {
+					fmt.Fprintf(stderr, "warning: cannot watch directory %s: %v\n", path, err)
+					return nil
+				}
+
+				watched[path] = true
+			}
+
+			return nil
+		})
+	}
+	watchDirs()
+	fmt.Fprintln(stderr, "watching for changes")
+
+	var (
+		pending  = map[string]bool{}
+		debounce = time.NewTimer(watchDebounce)
+	)
+	debounce.Stop()
+	for {
+		select {
+		case <-stop:
+			return exitCodeOK
+
+		case ev, ok := <-fsw.Events:
+			if !ok {
+				return exitCodeOK
+			}
+
+			base := filepath.Base(ev.Name)
+			if ev.Has(fsnotify.Create) && !ignoredDir(base) {
+				// the new directories, e.g. of new packages, aren't watched
+				// until they are added
+				if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+					watchTree(ev.Name)
+					pending[filepath.Clean(ev.Name)] = true
+					debounce.Reset(watchDebounce)
+					continue
+				}
+			}
+
+			if !strings.HasSuffix(base, ".go") && base != "go.mod" && base != "go.sum" {
+				continue
+			}
+
+			pending[filepath.Clean(ev.Name)] = true
+			debounce.Reset(watchDebounce)
+
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return exitCodeOK
+			}
+
+			fmt.Fprintf(stderr, "warning: file watcher: %v\n", err)
+
+		case <-debounce.C:
+			filenames := make([]string, 0, len(pending))
+			for f := range pending {
+				filenames = append(filenames, f)
+			}
+			pending = map[string]bool{}
+
+			_, changes, err := w.update(filenames)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				continue
+			}
+
+			watchDirs()
+			if err := printWatchChanges(stdout, cmdp.output, changes); err != nil {
+				fmt.Fprintln(stderr, err)
+			}
+		}
+	}
+}
+
+// ignoredDir returns true if the directory named name is ignored by the go
+// command when matching packages, hence it's never watched.
+func ignoredDir(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata"
+}
+
+// interruptChan returns a channel which is closed when the process receives
+// an interrupt signal.
+func interruptChan() <-chan struct{} {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+
+	stop := make(chan struct{})
+	go func() {
+		<-sigs
+		signal.Stop(sigs)
+		close(stop)
+	}()
+
+	return stop
+}
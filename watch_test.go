@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buf.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buf.String()
+}
+
+// newWatchModule creates a module in a temporary directory with a package
+// whose function F calls strings.Compare. It returns the module directory and
+// a function for writing files in it.
+func newWatchModule(t *testing.T) (string, func(name string, content string)) {
+	modDir := t.TempDir()
+	writeFile := func(name string, content string) {
+		t.Helper()
+		filename := filepath.Join(modDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0o755))
+		require.NoError(t, os.WriteFile(filename, []byte(content), 0o644))
+	}
+
+	writeFile("go.mod", "module example.com/watchtest\n\ngo 1.22\n")
+	writeFile("a/a.go", "package a\n\nimport \"strings\"\n\nfunc F() { strings.Compare(\"a\", \"b\") }\n")
+	return modDir, writeFile
+}
+
+func watchParams(t *testing.T, args ...string) cmdParams {
+	cmdp, err := params(append([]string{"-funcs", "strings.Compare"}, args...))
+	require.NoError(t, err)
+	return cmdp
+}
+
+func TestWatcherUpdate(t *testing.T) {
+	modDir, writeFile := newWatchModule(t)
+
+	w, results, err := newWatcher(modDir, watchParams(t, "./..."))
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, 1, countMatches(results[0].funcsFiles))
+
+	funcs := func(frs []funcResult) []string {
+		var names []string
+		for _, fr := range frs {
+			names = append(names, fr.FullName)
+		}
+
+		return names
+	}
+
+	t.Run("changed file", func(t *testing.T) {
+		writeFile("a/a.go", "package a\n\nimport \"strings\"\n\nfunc G() { strings.Compare(\"a\", \"b\") }\n")
+		_, changes, err := w.update([]string{filepath.Join(modDir, "a", "a.go")})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"example.com/watchtest/a.G"}, funcs(changes.Added))
+		assert.Equal(t, []string{"example.com/watchtest/a.F"}, funcs(changes.Removed))
+	})
+
+	t.Run("moved function", func(t *testing.T) {
+		writeFile("a/a.go", "package a\n\nimport \"strings\"\n\n// G moved.\nfunc G() { strings.Compare(\"a\", \"b\") }\n")
+		_, changes, err := w.update([]string{filepath.Join(modDir, "a", "a.go")})
+		require.NoError(t, err)
+		assert.Empty(t, changes.Added)
+		assert.Empty(t, changes.Removed)
+	})
+
+	t.Run("new package", func(t *testing.T) {
+		writeFile("c/c.go", "package c\n\nimport \"strings\"\n\nfunc H() { strings.Compare(\"a\", \"b\") }\n")
+		_, changes, err := w.update([]string{filepath.Join(modDir, "c", "c.go")})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"example.com/watchtest/c.H"}, funcs(changes.Added))
+		assert.Empty(t, changes.Removed)
+		assert.Contains(t, w.dirs(), filepath.Join(modDir, "c"))
+	})
+}
+
+func TestWatcherUpdateDependencies(t *testing.T) {
+	modDir, writeFile := newWatchModule(t)
+	funcs := func(frs []funcResult) []string {
+		var names []string
+		for _, fr := range frs {
+			names = append(names, fr.FullName)
+		}
+
+		return names
+	}
+
+	t.Run("imported package which doesn't match the patterns", func(t *testing.T) {
+		writeFile("b/b.go", "package b\n\nimport \"strings\"\n\ntype T struct{ strings.Builder }\n")
+		writeFile("a/a.go", "package a\n\nimport \"example.com/watchtest/b\"\n\nfunc F(t b.T) { t.Reset() }\n")
+
+		cmdp, err := params([]string{"-funcs", "strings.Builder.Reset", "./a"})
+		require.NoError(t, err)
+
+		w, results, err := newWatcher(modDir, cmdp)
+		require.NoError(t, err)
+		require.Equal(t, 1, countMatches(results[0].funcsFiles))
+		assert.Contains(t, w.dirs(), filepath.Join(modDir, "b"))
+
+		writeFile("b/b.go", "package b\n\nimport \"strings\"\n\ntype T struct{ strings.Builder }\n\nfunc (T) Reset() {}\n")
+		_, changes, err := w.update([]string{filepath.Join(modDir, "b", "b.go")})
+		require.NoError(t, err)
+		assert.Empty(t, changes.Added)
+		assert.Equal(t, []string{"example.com/watchtest/a.F"}, funcs(changes.Removed))
+	})
+
+	t.Run("indirect calls", func(t *testing.T) {
+		writeFile("b/b.go", "package b\n\nfunc Run(f func(string, string) int) int { return f(\"a\", \"b\") }\n")
+		writeFile("a/a.go", "package a\n\nimport (\n\t\"strings\"\n\n\t\"example.com/watchtest/b\"\n)\n\n"+
+			"func F() int { return b.Run(strings.Compare) }\n")
+
+		cmdp, err := params([]string{"-indirect", "-funcs", "strings.Compare", "./..."})
+		require.NoError(t, err)
+
+		w, results, err := newWatcher(modDir, cmdp)
+		require.NoError(t, err)
+		require.Equal(t, 1, countMatches(results[0].funcsFiles))
+
+		// b.Run doesn't call strings.Compare after a stops passing it, although
+		// b hasn't changed
+		writeFile("a/a.go", "package a\n\nimport \"example.com/watchtest/b\"\n\n"+
+			"func F() int { return b.Run(func(string, string) int { return 0 }) }\n")
+		_, changes, err := w.update([]string{filepath.Join(modDir, "a", "a.go")})
+		require.NoError(t, err)
+		assert.Empty(t, changes.Added)
+		assert.Equal(t, []string{"example.com/watchtest/b.Run"}, funcs(changes.Removed))
+	})
+}
+
+func TestPrintWatchChanges(t *testing.T) {
+	changes := watchChanges{
+		Added:   []funcResult{{Rule: "r", Severity: severityWarning, Func: "G", Filename: "/a.go", Line: 3, Column: 1}},
+		Removed: []funcResult{{Rule: "r", Severity: severityWarning, Func: "F", Filename: "/a.go", Line: 5, Column: 1}},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, printWatchChanges(&buf, outputOptions{format: formatText, pathMode: pathDisk}, changes))
+	assert.Equal(t, "- /a.go:5:1: F: r[warning]\n+ /a.go:3:1: G: r[warning]\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, printWatchChanges(&buf, outputOptions{format: formatText}, watchChanges{}))
+	assert.Empty(t, buf.String())
+
+	buf.Reset()
+	require.NoError(t, printWatchChanges(&buf, outputOptions{format: formatJSON}, watchChanges{Added: changes.Added}))
+	assert.True(t, strings.HasPrefix(buf.String(), `{"added":[{"rule":"r"`), buf.String())
+	assert.True(t, strings.HasSuffix(buf.String(), "\"removed\":[]}\n"), buf.String())
+}
+
+func TestRunWatch(t *testing.T) {
+	modDir, writeFile := newWatchModule(t)
+
+	var (
+		stdout, stderr syncBuffer
+		stop           = make(chan struct{})
+		done           = make(chan int)
+	)
+	go func() {
+		done <- runWatch(modDir, watchParams(t, "-path", pathModule, "./..."), &stdout, &stderr, stop)
+	}()
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(stderr.String(), "watching for changes")
+	}, time.Minute, 50*time.Millisecond, "stderr: %s", stderr.String())
+	assert.Equal(t, "a/a.go:5:1: F: default[warning]\n", stdout.String())
+
+	writeFile("a/a.go", "package a\n\nimport \"strings\"\n\nfunc G() { strings.Compare(\"a\", \"b\") }\n")
+	require.Eventually(t, func() bool {
+		return strings.Contains(stdout.String(), "+ a/a.go:5:1: G: default[warning]\n")
+	}, time.Minute, 50*time.Millisecond, "stdout: %s\nstderr: %s", stdout.String(), stderr.String())
+	assert.Contains(t, stdout.String(), "- a/a.go:5:1: F: default[warning]\n")
+
+	// the directories of the new packages are watched too
+	writeFile("c/c.go", "package c\n\nimport \"strings\"\n\nfunc H() { strings.Compare(\"a\", \"b\") }\n")
+	writeFile("d/e/e.go", "package e\n\nimport \"strings\"\n\nfunc I() { strings.Compare(\"a\", \"b\") }\n")
+	require.Eventually(t, func() bool {
+		return strings.Contains(stdout.String(), "+ c/c.go:5:1: H: default[warning]\n") &&
+			strings.Contains(stdout.String(), "+ d/e/e.go:5:1: I: default[warning]\n")
+	}, time.Minute, 50*time.Millisecond, "stdout: %s\nstderr: %s", stdout.String(), stderr.String())
+
+	writeFile("c/c.go", "package c\n\nimport \"strings\"\n\nfunc J() { strings.Compare(\"a\", \"b\") }\n")
+	require.Eventually(t, func() bool {
+		return strings.Contains(stdout.String(), "+ c/c.go:5:1: J: default[warning]\n")
+	}, time.Minute, 50*time.Millisecond, "stdout: %s\nstderr: %s", stdout.String(), stderr.String())
+
+	close(stop)
+	assert.Equal(t, exitCodeOK, <-done)
+}
+
+func TestParamsWatch(t *testing.T) {
+	cmdp, err := params([]string{"-watch", "-funcs", "strings.Compare", "./..."})
+	require.NoError(t, err)
+	assert.True(t, cmdp.watch)
+
+	_, err = params([]string{"-watch", "-diff", "HEAD", "-funcs", "strings.Compare", "./..."})
+	require.Error(t, err)
+
+	_, err = params([]string{"-watch", "-baseline", baselineModeCheck, "-baseline-file", "bl.json", "-funcs", "strings.Compare"})
+	require.Error(t, err)
+}